@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+const explainUsage = `usage: splunk-ds-camr explain [-json] <hostname>
+
+Traces a host through the sync pipeline: CMDB records, lanes, routing rules,
+the generated pattern covering it and the server classes that whitelist it
+in each target's current serverclass.conf.
+`
+
+func runExplain(ctx context.Context, r *runner.Runner, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, explainUsage) }
+	asJSON := fs.Bool("json", false, "print the explanation as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	ex, err := r.Explain(ctx, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(ex); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	printExplanation(stdout, ex)
+	return 0
+}
+
+func printExplanation(w io.Writer, ex runner.Explanation) {
+	fmt.Fprintf(w, "host %s\n\n", ex.Host)
+
+	fmt.Fprintf(w, "CMDB: %d record(s)\n", len(ex.Records))
+	if len(ex.Records) == 0 {
+		fmt.Fprintln(w, "  not found (or dropped by the CMDB client, e.g. for a missing lane)")
+	}
+	for _, rec := range ex.Records {
+		e := rec.Entry
+		fmt.Fprintf(w, "  - hostname=%s lane=%q -> lanes %v", e.Hostname, e.BusinessServiceLane, rec.Lanes)
+		for _, kv := range [][2]string{{"id", e.ID}, {"environment", e.Environment}, {"os", e.OS}, {"ip", e.IPAddress}} {
+			if kv[1] != "" {
+				fmt.Fprintf(w, " %s=%s", kv[0], kv[1])
+			}
+		}
+		fmt.Fprintln(w)
+		for _, st := range rec.Route.Trace {
+			verdict := "no match"
+			if st.Matched {
+				verdict = "MATCH -> " + strings.Join(st.Destinations, ", ")
+				if st.Final {
+					verdict += " (final)"
+				}
+			}
+			fmt.Fprintf(w, "      rule %s (priority %d): %s: %s\n", st.Rule, st.Priority, verdict, st.Reason)
+		}
+		if len(rec.Route.Destinations) == 0 {
+			fmt.Fprintln(w, "      no routing rule matched: the host is not whitelisted anywhere")
+		}
+	}
+
+	fmt.Fprintln(w, "\nDestinations:")
+	if len(ex.Destinations) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, d := range ex.Destinations {
+		fmt.Fprintf(w, "  %s (%d hosts)\n", d.Name, d.Hosts)
+	}
+
+	for _, t := range ex.Targets {
+		fmt.Fprintf(w, "\nTarget %s (%s)", t.Target, t.File)
+		if t.Paused {
+			fmt.Fprint(w, " PAUSED: automatic updates are off")
+		}
+		fmt.Fprintln(w)
+		if len(t.Classes) == 0 {
+			fmt.Fprintln(w, "  no class manages or matches the host")
+		}
+		for _, c := range t.Classes {
+			fmt.Fprintf(w, "  class %s", c.Class)
+			if len(c.Apps) > 0 {
+				fmt.Fprintf(w, " (apps %s -> destination %s)", strings.Join(c.Apps, ", "), c.Destination)
+			}
+			fmt.Fprintf(w, ": %s\n", classVerdict(c))
+			if len(c.Patterns) > 0 {
+				fmt.Fprintf(w, "      generated pattern %s\n", strings.Join(c.Patterns, ", "))
+			} else if c.Expected {
+				fmt.Fprintln(w, "      no generated pattern matches the host")
+			}
+			for _, e := range c.Whitelisted {
+				fmt.Fprintf(w, "      whitelisted by %s = %s%s\n", e.Key, e.Pattern, managedTag(e.Managed))
+			}
+			for _, e := range c.Blacklisted {
+				fmt.Fprintf(w, "      blacklisted by %s = %s%s\n", e.Key, e.Pattern, managedTag(e.Managed))
+			}
+			for _, u := range c.Unresolved {
+				fmt.Fprintf(w, "      host list %s not readable here; not checked\n", u)
+			}
+		}
+	}
+}
+
+func classVerdict(c runner.ClassExplanation) string {
+	switch {
+	case c.Expected && c.Included():
+		return "included, as expected"
+	case c.Expected && len(c.Blacklisted) > 0:
+		return "EXCLUDED by blacklist, although routed to its destination"
+	case c.Expected:
+		return "NOT whitelisted yet, although routed to its destination (next cycle, dry-run or paused?)"
+	case c.Included() && len(c.Apps) > 0:
+		return "included, but NOT routed to its destination (stale or hand-made entry)"
+	case c.Included():
+		return "included (class not managed by this tool)"
+	default:
+		return "not included"
+	}
+}
+
+func managedTag(managed bool) string {
+	if managed {
+		return ""
+	}
+	return "  [hand-managed]"
+}
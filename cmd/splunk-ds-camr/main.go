@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -11,11 +12,22 @@ import (
 	"github.com/example/splunk-ds-camr/internal/cmdb"
 	sn "github.com/example/splunk-ds-camr/internal/cmdb/servicenow"
 	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/httpapi"
 	"github.com/example/splunk-ds-camr/internal/logging"
-	"github.com/example/splunk-ds-camr/internal/patterns"
-	"github.com/example/splunk-ds-camr/internal/serverclass"
+	"github.com/example/splunk-ds-camr/internal/runner"
 )
 
+const usage = `usage: splunk-ds-camr [command]
+
+commands:
+  run       sync continuously (default; CAMR_ONCE=1 for a single cycle)
+  rollback  list, diff and restore serverclass.conf backups
+  plan      show what the next cycle would write and which hosts each pattern matches
+  explain   trace why a host is (or is not) in a server class
+  verify    check the current serverclass.conf against the CMDB (exit 3 on violations)
+  reconcile compare deployment server phone-home data with the CMDB (exit 3 on findings)
+`
+
 func main() {
 	cfgPath := "config.yaml"
 	if v := os.Getenv("CAMR_CONFIG"); v != "" {
@@ -47,18 +59,43 @@ func main() {
 		cfg.DryRun = true
 	}
 
-	updater := serverclass.NewUpdater(serverclass.Config{
-		Path:           cfg.Serverclass.Path,
-		Backup:         cfg.Serverclass.Backup,
-		AppClass:       cfg.Serverclass.AppClass,
-		AppDestination: cfg.Serverclass.AppDestination,
-		DryRun:         cfg.DryRun,
-		DryRunApps:     cfg.Serverclass.DryRunApps,
-	})
+	if v := os.Getenv("CAMR_TRIGGER_TOKEN"); v != "" {
+		cfg.HTTP.TriggerToken = v
+	}
+	if v := os.Getenv("CAMR_WEBHOOK_SECRET"); v != "" {
+		cfg.CMDB.ServiceNow.WebhookSecret = v
+	}
+
+	// One runner drives every serverclass target from a single CMDB fetch per cycle
+	r, err := runner.New(cfg, cmdbClient)
+	if err != nil {
+		slog.Error("invalid config", "err", err)
+		os.Exit(1)
+	}
+
+	// Subcommands; no argument (or "run") keeps the long-running behaviour
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+		case "rollback":
+			os.Exit(runRollback(ctx, r, os.Args[2:], os.Stdout, os.Stderr))
+		case "plan":
+			os.Exit(runPlan(ctx, r, cfg.DeploymentServer, os.Args[2:], os.Stdout, os.Stderr))
+		case "explain":
+			os.Exit(runExplain(ctx, r, os.Args[2:], os.Stdout, os.Stderr))
+		case "verify":
+			os.Exit(runVerify(ctx, r, os.Args[2:], os.Stdout, os.Stderr))
+		case "reconcile":
+			os.Exit(runReconcile(ctx, r, cfg.DeploymentServer, os.Args[2:], os.Stdout, os.Stderr))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+			os.Exit(2)
+		}
+	}
 
 	// One-shot mode for testing/automation
 	if once := os.Getenv("CAMR_ONCE"); once == "1" || once == "true" {
-		if err := runOnce(ctx, cmdbClient, updater, cfg); err != nil {
+		if err := r.RunOnce(ctx); err != nil {
 			slog.Error("run once failed", "err", err)
 			os.Exit(1)
 		}
@@ -66,12 +103,44 @@ func main() {
 		return
 	}
 
+	if cfg.HTTP.Listen != "" {
+		opts := httpapi.Options{
+			RefreshInterval: cfg.RefreshInterval.Duration,
+			StaleCycles:     cfg.HTTP.StaleCycles,
+			Config:          cfg,
+			TriggerToken:    cfg.HTTP.TriggerToken,
+		}
+		// event-driven resyncs; the periodic poll stays as the safety net
+		if sncfg := cfg.CMDB.ServiceNow; cfg.CMDB.Type == "servicenow" && sncfg.WebhookSecret != "" {
+			opts.ServiceNowWebhook = sn.WebhookHandler(sncfg.WebhookSecret, sncfg.Table, func(ids ...string) bool {
+				return r.NotifyChanged("servicenow webhook", ids...)
+			})
+		}
+		h := httpapi.New(r, opts)
+		if err := serveHTTP(ctx, cfg.HTTP.Listen, h); err != nil {
+			slog.Error("http listener", "addr", cfg.HTTP.Listen, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// SIGUSR1 triggers an immediate cycle, like POST /api/sync
+	if len(triggerSignals) > 0 {
+		usr1 := make(chan os.Signal, 1)
+		signal.Notify(usr1, triggerSignals...)
+		go func() {
+			for sig := range usr1 {
+				r.Trigger("signal " + sig.String())
+			}
+		}()
+	}
+
 	ticker := time.NewTicker(cfg.RefreshInterval.Duration)
 	defer ticker.Stop()
 
-	slog.Info("starting", "refreshInterval", cfg.RefreshInterval.Duration.String())
+	slog.Info("starting", "refreshInterval", cfg.RefreshInterval.Duration.String(), "targets", len(r.Targets()))
+	run := r.RunOnce
 	for {
-		if err := runOnce(ctx, cmdbClient, updater, cfg); err != nil {
+		if err := run(ctx); err != nil {
 			slog.Error("run error", "err", err)
 		}
 
@@ -80,53 +149,10 @@ func main() {
 			slog.Info("shutting down")
 			return
 		case <-ticker.C:
+			run = r.RunOnce
+		case <-r.Triggers():
+			// the periodic full cycle keeps its schedule as a safety net
+			run = r.RunTriggered
 		}
 	}
 }
-
-func runOnce(ctx context.Context, c cmdb.Client, u *serverclass.Updater, cfg *config.Config) error {
-	entries, err := c.Fetch(ctx)
-	if err != nil {
-		return err
-	}
-
-	// Build lane -> destination map from destination -> lanes config
-	destByLane := map[string]string{}
-	for dest, lanes := range cfg.Destinations {
-		for _, lane := range lanes {
-			destByLane[lane] = dest
-		}
-	}
-	hostsByDest := map[string][]string{}
-	for _, e := range entries {
-		dest := destByLane[e.BusinessServiceLane]
-		if dest == "" {
-			continue // skip unknown lanes
-		}
-		hostsByDest[dest] = append(hostsByDest[dest], e.Hostname)
-	}
-
-	// compress hosts into wildcard patterns per destination
-	patternsByDest := map[string][]string{}
-	for dest, hosts := range hostsByDest {
-		opts := patterns.Options{
-			Mode:                  cfg.Wildcard.Mode,
-			MinGroupSize:          cfg.Wildcard.MinGroupSize,
-			RequireMinFixedPrefix: cfg.Wildcard.RequireMinFixedPrefix,
-		}
-		patternsByDest[dest] = patterns.GenerateWildcardsWithOptions(hosts, opts)
-	}
-
-	// update serverclass files for each destination mapping
-	for app, class := range cfg.Serverclass.AppClass {
-		dest := cfg.Serverclass.AppDestination[app]
-		if dest == "" {
-			continue
-		}
-		patterns := patternsByDest[dest]
-		if err := u.UpdateWhitelist(app, class, patterns); err != nil {
-			return err
-		}
-	}
-	return nil
-}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/dsclients"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+const planUsage = `usage: splunk-ds-camr plan [-json] [-all]
+
+Shows what the next cycle would write: the patterns each class gains and loses, each
+with the number and a sample of the CMDB hosts it matches. Matched hosts routed to
+another destination, routed nowhere or (with deploymentServer configured) phoning
+home without a CMDB record are flagged. Nothing is written.
+`
+
+func runPlan(ctx context.Context, r *runner.Runner, ds config.DeploymentServerConfig, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, planUsage) }
+	asJSON := fs.Bool("json", false, "print the plan as JSON")
+	all := fs.Bool("all", false, "also list the patterns that stay unchanged")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	// phoning-home clients are optional: only an unconfigured deployment server is skipped
+	var clients []dsclients.Client
+	src, err := dsclients.New(ds)
+	switch {
+	case errors.Is(err, dsclients.ErrNotConfigured):
+	case err != nil:
+		fmt.Fprintln(stderr, err)
+		return 1
+	default:
+		if clients, err = src.Clients(ctx); err != nil {
+			fmt.Fprintf(stderr, "warning: deployment clients not taken into account: %v\n", err)
+		}
+	}
+	plan, err := r.Plan(ctx, clients)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(plan); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	printPlan(stdout, plan, *all)
+	return 0
+}
+
+func printPlan(w io.Writer, plan runner.Plan, all bool) {
+	fmt.Fprintf(w, "CMDB: %d entries (snapshot %s)", plan.Entries, plan.Snapshot)
+	if plan.Clients > 0 {
+		fmt.Fprintf(w, ", %d phone-home clients not in the CMDB", plan.Clients)
+	}
+	fmt.Fprintln(w)
+	for _, t := range plan.Targets {
+		fmt.Fprintf(w, "\nTarget %s (%s)", t.Target, t.File)
+		if t.Paused {
+			fmt.Fprint(w, " PAUSED: nothing will be written until resumed")
+		}
+		fmt.Fprintln(w)
+		for _, c := range t.Classes {
+			add, keep, remove := c.Counts()
+			fmt.Fprintf(w, "  class %s (app %s -> %s, %d hosts, %s): +%d -%d =%d\n", c.Class, c.App, c.Destination, c.Hosts, c.Mode, add, remove, keep)
+			if c.MaxPatterns > 0 && add+keep > c.MaxPatterns {
+				fmt.Fprintf(w, "    ! %d patterns exceed maxPatterns %d\n", add+keep, c.MaxPatterns)
+			}
+			for _, p := range c.Patterns {
+				if p.Change == runner.ChangeKeep && !all {
+					continue
+				}
+				printPreview(w, p)
+			}
+		}
+	}
+}
+
+var changeMarks = map[string]string{runner.ChangeAdd: "+", runner.ChangeKeep: "=", runner.ChangeRemove: "-"}
+
+func printPreview(w io.Writer, p runner.PatternPreview) {
+	sample := strings.Join(p.Sample, ", ")
+	if p.Matches > len(p.Sample) {
+		sample += ", ..."
+	}
+	fmt.Fprintf(w, "    %s %-30s %4d hosts: %s\n", changeMarks[p.Change], p.Pattern, p.Matches, sample)
+	for _, f := range p.Foreign {
+		fmt.Fprintf(w, "        ! also matches %s of %s\n", f.Host, strings.Join(f.Destinations, ", "))
+	}
+	for _, h := range p.Unknown {
+		fmt.Fprintf(w, "        ? also matches unknown host %s\n", h)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/dsclients"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+const reconcileUsage = `usage: splunk-ds-camr reconcile [-json] [-file EXPORT]
+
+Compares the clients phoning home to the deployment server (deploymentServer.url or
+.file, or -file) with the CMDB and reports clients missing from the CMDB, CMDB hosts
+that never (or no longer) phone home and clients whose names differ from their CMDB
+hostname. Exits 3 when anything is reported.
+`
+
+func runReconcile(ctx context.Context, r *runner.Runner, cfg config.DeploymentServerConfig, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, reconcileUsage) }
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	file := fs.String("file", "", "read an export of services/deployment/server/clients instead of the configured source")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if *file != "" {
+		cfg.URL, cfg.File = "", *file
+	}
+	if cfg.StaleAfter.Duration == 0 {
+		cfg.StaleAfter = config.Duration{Duration: 24 * time.Hour}
+	}
+	src, err := dsclients.New(cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	rep, err := r.Reconcile(ctx, src, cfg.StaleAfter.Duration)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	} else {
+		printReconciliation(stdout, rep, cfg.StaleAfter.Duration)
+	}
+	if !rep.OK() {
+		return exitViolations
+	}
+	return 0
+}
+
+func printReconciliation(w io.Writer, rep dsclients.Report, staleAfter time.Duration) {
+	fmt.Fprintf(w, "%d deployment clients, %d CMDB hosts\n", rep.Clients, rep.Hosts)
+	if rep.OK() {
+		fmt.Fprintln(w, "\nOK: every client is in the CMDB and every CMDB host phones home")
+		return
+	}
+	if len(rep.Unknown) > 0 {
+		fmt.Fprintf(w, "\nPhone home but not in the CMDB (%d):\n", len(rep.Unknown))
+		for _, c := range rep.Unknown {
+			fmt.Fprintf(w, "  %s%s\n", strings.Join(c.Names(), " / "), lastSeen(c.LastPhoneHome))
+		}
+	}
+	if len(rep.Silent) > 0 {
+		fmt.Fprintf(w, "\nIn the CMDB but not phoning home within %s (%d):\n", staleAfter, len(rep.Silent))
+		for _, h := range rep.Silent {
+			if h.LastPhoneHome.IsZero() {
+				fmt.Fprintf(w, "  %s: never\n", h.Host)
+				continue
+			}
+			fmt.Fprintf(w, "  %s:%s\n", h.Host, lastSeen(h.LastPhoneHome))
+		}
+	}
+	if len(rep.Mismatches) > 0 {
+		fmt.Fprintf(w, "\nNames differ from the CMDB, patterns miss them (%d):\n", len(rep.Mismatches))
+		for _, m := range rep.Mismatches {
+			fmt.Fprintf(w, "  CMDB %s <- client %s (matched by %s)\n", m.Host, strings.Join(m.Client.Names(), " / "), m.LinkedBy)
+		}
+	}
+}
+
+func lastSeen(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return " last phoned home " + t.Format("2006-01-02 15:04:05Z")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/example/splunk-ds-camr/internal/runner"
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+const rollbackUsage = `usage: splunk-ds-camr rollback <action> [-target NAME] [args]
+
+actions:
+  list                     list backups (newest first) with line changes against the current file
+  diff <backup>            show the diff from the current file to a backup
+  restore [-reload] <backup>
+                           back up the current file, restore the backup atomically and pause
+                           automatic updates; -reload runs the target's reloadCommand
+  resume                   resume automatic updates after a restore
+
+<backup> is an index from "list" (0 = newest) or a backup path.
+`
+
+func runRollback(ctx context.Context, r *runner.Runner, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, rollbackUsage)
+		return 2
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("rollback "+action, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	targetName := fs.String("target", "", "target name (required when several targets are configured)")
+	reload := fs.Bool("reload", false, "run the target's reloadCommand after restoring")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	t, err := r.Target(*targetName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	u := t.Updater
+
+	switch action {
+	case "list":
+		backups, err := u.ListBackups(u.Path())
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		cur, err := u.Current()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if p, _ := u.Paused(); p != nil {
+			fmt.Fprintf(stdout, "automatic updates PAUSED since %s (%s %s)\n", p.Since.Format("2006-01-02 15:04:05Z"), p.Reason, p.RestoredFrom)
+		}
+		if len(backups) == 0 {
+			fmt.Fprintf(stdout, "no backups of %s\n", u.Path())
+			return 0
+		}
+		for i, b := range backups {
+			data, err := u.ReadBackup(b)
+			if err != nil {
+				fmt.Fprintf(stdout, "%3d  %s  %s  (unreadable: %v)\n", i, b.Time.Format("2006-01-02 15:04:05Z"), b.Path, err)
+				continue
+			}
+			_, st := serverclass.UnifiedDiff(u.Path(), b.Path, cur, data)
+			changes := "identical to current"
+			if st.Added > 0 || st.Removed > 0 {
+				changes = fmt.Sprintf("+%d -%d lines vs current", st.Added, st.Removed)
+			}
+			fmt.Fprintf(stdout, "%3d  %s  %s  %s\n", i, b.Time.Format("2006-01-02 15:04:05Z"), b.Path, changes)
+		}
+		return 0
+
+	case "diff", "restore":
+		if fs.NArg() != 1 {
+			fmt.Fprint(stderr, rollbackUsage)
+			return 2
+		}
+		b, err := findBackup(u, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if action == "diff" {
+			cur, err := u.Current()
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			data, err := u.ReadBackup(b)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			d, _ := serverclass.UnifiedDiff(u.Path(), b.Path, cur, data)
+			if d == "" {
+				fmt.Fprintln(stdout, "backup is identical to the current file")
+			}
+			fmt.Fprint(stdout, d)
+			return 0
+		}
+		unlock, err := u.Lock(ctx)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		saved, err := u.Restore(b)
+		unlock()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if saved != "" {
+			fmt.Fprintf(stdout, "current file saved as %s\n", saved)
+		}
+		fmt.Fprintf(stdout, "restored %s from %s\nautomatic updates paused; run \"rollback resume\" to re-enable\n", u.Path(), b.Path)
+		if *reload {
+			if err := u.Reload(ctx); err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			fmt.Fprintln(stdout, "deployment server reloaded")
+		}
+		return 0
+
+	case "resume":
+		if err := u.Resume(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "automatic updates resumed for %s\n", u.Path())
+		return 0
+	}
+	fmt.Fprint(stderr, rollbackUsage)
+	return 2
+}
+
+// findBackup resolves a list index or a backup path.
+func findBackup(u *serverclass.Updater, ref string) (serverclass.Backup, error) {
+	backups, err := u.ListBackups(u.Path())
+	if err != nil {
+		return serverclass.Backup{}, err
+	}
+	if i, err := strconv.Atoi(ref); err == nil {
+		if i < 0 || i >= len(backups) {
+			return serverclass.Backup{}, fmt.Errorf("backup index %d out of range (%d backups)", i, len(backups))
+		}
+		return backups[i], nil
+	}
+	for _, b := range backups {
+		if b.Path == ref {
+			return b, nil
+		}
+	}
+	return serverclass.Backup{}, fmt.Errorf("%s is not a backup of %s", ref, u.Path())
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// triggerSignals is empty where SIGUSR1 does not exist; use POST /api/sync instead.
+var triggerSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// triggerSignals request an immediate sync cycle.
+var triggerSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+const verifyUsage = `usage: splunk-ds-camr verify [-json] [-target NAME]
+
+Evaluates the whitelists and blacklists of each target's current serverclass.conf
+against every CMDB host and reports hosts in the wrong class, hosts in no class,
+hosts in the classes of several destinations and whitelist entries matching no
+host. Exits 3 when violations are found.
+`
+
+// exitViolations is the exit status of verify when the check fails, so that a gate can
+// tell violations from errors (1) and usage mistakes (2).
+const exitViolations = 3
+
+func runVerify(ctx context.Context, r *runner.Runner, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, verifyUsage) }
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	targetName := fs.String("target", "", "only verify this target")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	v, err := r.Verify(ctx, *targetName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	} else {
+		printVerification(stdout, v)
+	}
+	if !v.OK() {
+		return exitViolations
+	}
+	return 0
+}
+
+func printVerification(w io.Writer, v runner.Verification) {
+	fmt.Fprintf(w, "CMDB: %d hosts (snapshot %s)\n", v.Hosts, v.Snapshot)
+	for _, t := range v.Targets {
+		fmt.Fprintf(w, "target %s (%s): %d classes\n", t.Target, t.File, t.Classes)
+		for _, u := range t.Unresolved {
+			fmt.Fprintf(w, "  warning: host list %s not readable here; not checked\n", u)
+		}
+	}
+	if v.OK() {
+		fmt.Fprintln(w, "\nOK: no violations")
+		return
+	}
+	fmt.Fprintf(w, "\n%d violation(s):\n", len(v.Violations))
+	for _, vi := range v.Violations {
+		subject := vi.Host
+		if subject == "" {
+			subject = "class " + vi.Class
+		}
+		target := vi.Target
+		if target == "" {
+			target = "-" // unrouted host, not one target's concern
+		}
+		fmt.Fprintf(w, "  [%s] %-22s %s: %s\n", target, vi.Kind, subject, vi.Detail)
+	}
+}
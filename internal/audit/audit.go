@@ -0,0 +1,99 @@
+// Package audit appends a JSON Lines record for every serverclass change, separate from
+// the rotating application log, so the history of each class is never rotated away.
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+// Record kinds.
+const (
+	KindWhitelist = "whitelist" // patterns added to or removed from a class
+	KindStanza    = "stanza"    // a managed stanza setting created or reset
+)
+
+// Record is one line of the audit log.
+type Record struct {
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	Target      string    `json:"target"`
+	File        string    `json:"file"`
+	Class       string    `json:"class,omitempty"`
+	App         string    `json:"app,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Added       []string  `json:"added,omitempty"`
+	Removed     []string  `json:"removed,omitempty"`
+	// AddedHosts maps each added pattern to the destination hosts it covers now;
+	// RemovedHosts maps each removed pattern to the hosts it covered in the previous cycle.
+	AddedHosts   map[string][]string `json:"addedHosts,omitempty"`
+	RemovedHosts map[string][]string `json:"removedHosts,omitempty"`
+	// HostsJoined and HostsLeft are hosts routed to the destination that were not in the
+	// previous cycle, and hosts no longer routed to it. Empty after a restart.
+	HostsJoined []string           `json:"hostsJoined,omitempty"`
+	HostsLeft   []string           `json:"hostsLeft,omitempty"`
+	Drift       *serverclass.Drift `json:"drift,omitempty"` // for KindStanza
+	ConfigHash  string             `json:"configHash"`
+	Snapshot    string             `json:"cmdbSnapshot"`
+	Backups     []string           `json:"backups,omitempty"`
+	DryRun      bool               `json:"dryRun"`
+}
+
+// Log appends records to a file. A nil *Log discards records.
+type Log struct {
+	path string
+	mu   sync.Mutex
+	fs   afero.Fs
+}
+
+// New returns a log writing to path; the file is created on the first record.
+func New(path string) *Log {
+	return &Log{path: path, fs: afero.NewOsFs()}
+}
+
+// SetFS allows overriding the filesystem (e.g., in tests) with an in-memory FS.
+func (l *Log) SetFS(fs afero.Fs) { l.fs = fs }
+
+// Path returns the file the log appends to.
+func (l *Log) Path() string { return l.path }
+
+// Write appends records, one JSON object per line, and syncs the file. The file is only
+// ever opened for appending; existing lines are never rewritten.
+func (l *Log) Write(records ...Record) error {
+	if l == nil || len(records) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, rec := range records {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.fs.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	f, err := l.fs.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	_, werr := f.Write(buf)
+	if werr == nil {
+		werr = f.Sync()
+	}
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	return werr
+}
@@ -2,19 +2,76 @@ package cmdb
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/example/splunk-ds-camr/internal/config"
 )
 
+// SkippedEntries counts CMDB entries that end up in no whitelist, by reason
+// (e.g. missing_hostname, missing_lane, no_destination).
+var SkippedEntries = promauto.NewCounterVec(prometheus.CounterOpts{Name: "camr_entries_skipped_total",
+	Help: "CMDB entries not whitelisted anywhere, by reason."}, []string{"reason"})
+
 type Entry struct {
-	Hostname            string
+	// ID identifies the CMDB record (sys_id for ServiceNow); may be empty.
+	ID       string
+	Hostname string
+	// BusinessServiceLane holds one lane or several comma-separated lanes; use Lanes to read it.
 	BusinessServiceLane string
+	Environment         string
+	OS                  string
+	IPAddress           string
+}
+
+// Lanes returns the entry's lanes, split on commas, trimmed and without empties or duplicates.
+func (e Entry) Lanes() []string {
+	return SplitLanes(e.BusinessServiceLane)
+}
+
+// SnapshotID identifies a set of entries independent of their order: the first 16 hex
+// digits of the SHA-256 over the sorted entries.
+func SnapshotID(entries []Entry) string {
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = strings.Join([]string{e.ID, e.Hostname, e.BusinessServiceLane, e.Environment, e.OS, e.IPAddress}, "\t")
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SplitLanes parses a comma-separated lane field.
+func SplitLanes(s string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	return out
 }
 
 type Client interface {
 	Fetch(ctx context.Context) ([]Entry, error)
 }
 
+// RecordFetcher is implemented by clients that can fetch a single record by ID, for
+// targeted resyncs after change notifications.
+type RecordFetcher interface {
+	// FetchByID returns the record's entries, or none if it no longer exists or matches.
+	FetchByID(ctx context.Context, id string) ([]Entry, error)
+}
+
 type dummyClient struct {
 	entries []Entry
 }
@@ -22,7 +79,17 @@ type dummyClient struct {
 func NewDummy(cfg config.DummyCMDBConfig) Client {
 	d := &dummyClient{}
 	for _, e := range cfg.Entries {
-		d.entries = append(d.entries, Entry{Hostname: e.Hostname, BusinessServiceLane: e.BusinessServiceLane})
+		lanes := e.BusinessServiceLane
+		if len(e.BusinessServiceLanes) > 0 {
+			lanes = strings.Join(append(SplitLanes(lanes), e.BusinessServiceLanes...), ",")
+		}
+		d.entries = append(d.entries, Entry{
+			Hostname:            e.Hostname,
+			BusinessServiceLane: lanes,
+			Environment:         e.Environment,
+			OS:                  e.OS,
+			IPAddress:           e.IPAddress,
+		})
 	}
 	return d
 }
@@ -7,18 +7,30 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
 	"github.com/example/splunk-ds-camr/internal/cmdb"
 	"github.com/example/splunk-ds-camr/internal/config"
 )
 
+var (
+	pages = promauto.NewCounter(prometheus.CounterOpts{Name: "camr_servicenow_pages_total", Help: "ServiceNow table API pages fetched."})
+	rows  = promauto.NewCounter(prometheus.CounterOpts{Name: "camr_servicenow_rows_total", Help: "ServiceNow rows received, before filtering."})
+)
+
 type Client struct {
 	baseURL   string
 	table     string
 	query     string
 	hostField string
 	laneField string
+	envField  string
+	osField   string
+	ipField   string
 	pageSize  int
 	client    *http.Client
 	auth      config.ServiceNowAuth
@@ -41,6 +53,9 @@ func New(cfg config.ServiceNowConfig) *Client {
 		query:     cfg.Query,
 		hostField: ifEmpty(cfg.HostnameField, "host_name"),
 		laneField: ifEmpty(cfg.LaneField, "business_service_lane"),
+		envField:  ifEmpty(cfg.EnvironmentField, "environment"),
+		osField:   ifEmpty(cfg.OSField, "os"),
+		ipField:   ifEmpty(cfg.IPField, "ip_address"),
 		pageSize:  cfg.PageSize,
 		client:    &http.Client{Transport: tr, Timeout: cfg.Timeout.Duration},
 		auth:      cfg.Auth,
@@ -62,6 +77,7 @@ func (c *Client) Fetch(ctx context.Context) ([]cmdb.Entry, error) {
 		if err != nil {
 			return nil, err
 		}
+		pages.Inc()
 		out = append(out, batch...)
 		start += len(batch)
 		if start >= total || len(batch) == 0 {
@@ -71,15 +87,52 @@ func (c *Client) Fetch(ctx context.Context) ([]cmdb.Entry, error) {
 	return out, nil
 }
 
+// FetchByID fetches a single CI by sys_id, through the configured query: a CI that no
+// longer matches the query (or was deleted) yields no entries. The sys_id condition is
+// added to every ^NQ (OR) branch of the query, so no branch can return other records.
+func (c *Client) FetchByID(ctx context.Context, sysID string) ([]cmdb.Entry, error) {
+	if !ValidSysID(sysID) {
+		return nil, fmt.Errorf("invalid sys_id %q", sysID)
+	}
+	cond := "sys_id=" + sysID
+	query := cond
+	if c.query != "" {
+		branches := strings.Split(c.query, "^NQ")
+		for i, b := range branches {
+			branches[i] = b + "^" + cond
+		}
+		query = strings.Join(branches, "^NQ")
+	}
+	entries, _, err := c.fetchPageQuery(ctx, query, 0)
+	return entries, err
+}
+
+// ValidSysID reports whether id is a ServiceNow sys_id: 32 hexadecimal characters.
+func ValidSysID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, r := range id {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Client) fetchPage(ctx context.Context, offset int) ([]cmdb.Entry, int, error) {
+	return c.fetchPageQuery(ctx, c.query, offset)
+}
+
+func (c *Client) fetchPageQuery(ctx context.Context, query string, offset int) ([]cmdb.Entry, int, error) {
 	u, err := url.Parse(c.baseURL)
 	if err != nil {
 		return nil, 0, err
 	}
 	u.Path = fmt.Sprintf("/api/now/table/%s", c.table)
 	q := u.Query()
-	if c.query != "" {
-		q.Set("sysparm_query", c.query)
+	if query != "" {
+		q.Set("sysparm_query", query)
 	}
 	q.Set("sysparm_offset", fmt.Sprint(offset))
 	q.Set("sysparm_limit", fmt.Sprint(c.pageSize))
@@ -110,14 +163,24 @@ func (c *Client) fetchPage(ctx context.Context, offset int) ([]cmdb.Entry, int,
 	if err := dec.Decode(&r); err != nil {
 		return nil, 0, err
 	}
+	rows.Add(float64(len(r.Result)))
 	var out []cmdb.Entry
 	for _, row := range r.Result {
 		h, _ := row[c.hostField].(string)
-		lane, _ := row[c.laneField].(string)
-		if h == "" || lane == "" {
+		lane := laneValue(row[c.laneField])
+		if h == "" {
+			cmdb.SkippedEntries.WithLabelValues("missing_hostname").Inc()
 			continue
 		}
-		out = append(out, cmdb.Entry{Hostname: h, BusinessServiceLane: lane})
+		if lane == "" {
+			cmdb.SkippedEntries.WithLabelValues("missing_lane").Inc()
+			continue
+		}
+		env, _ := row[c.envField].(string)
+		osName, _ := row[c.osField].(string)
+		ip, _ := row[c.ipField].(string)
+		id, _ := row["sys_id"].(string)
+		out = append(out, cmdb.Entry{ID: id, Hostname: h, BusinessServiceLane: lane, Environment: env, OS: osName, IPAddress: ip})
 	}
 	// NOTE: ServiceNow API variations may use total count in headers; we use len+offset fallback
 	total := r.Total
@@ -127,5 +190,22 @@ func (c *Client) fetchPage(ctx context.Context, offset int) ([]cmdb.Entry, int,
 	return out, total, nil
 }
 
+// laneValue accepts a lane field returned either as a (comma-separated) string or a JSON list.
+func laneValue(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []any:
+		parts := make([]string, 0, len(t))
+		for _, x := range t {
+			if s, ok := x.(string); ok && s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ",")
+	}
+	return ""
+}
+
 // Allow the package to compile on older Go versions where any import might be unused
 var _ = time.Now
@@ -0,0 +1,159 @@
+package servicenow
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of TimestampHeader's value, a '.' and the raw
+// request body, keyed with the shared webhook secret, as hex (optionally prefixed
+// "sha256=") or base64.
+const SignatureHeader = "X-Camr-Signature"
+
+// TimestampHeader carries the time the notification was sent, in Unix seconds. Requests
+// more than maxWebhookSkew away from the receiver's clock are rejected, so a captured
+// notification cannot be replayed later; within the window a replay only re-fetches the
+// same records.
+const TimestampHeader = "X-Camr-Timestamp"
+
+// maxWebhookBody bounds the size of a notification.
+const maxWebhookBody = 1 << 20
+
+// maxWebhookSkew is how far a notification's timestamp may be off.
+const maxWebhookSkew = 5 * time.Minute
+
+var webhookEvents = promauto.NewCounterVec(prometheus.CounterOpts{Name: "camr_webhook_events_total",
+	Help: "ServiceNow change notifications by result (queued, coalesced, ignored, invalid, unauthorized)."}, []string{"result"})
+
+// Event is a change notification sent by a ServiceNow business rule or outbound REST
+// message. Only the record's sys_id is used: the record itself is re-fetched through the
+// configured query, so the notification cannot inject data.
+type Event struct {
+	Table     string `json:"table"`
+	Operation string `json:"operation"` // insert, update or delete
+	SysID     string `json:"sys_id"`
+}
+
+// WebhookHandler verifies and decodes notifications (one event object or an array of them)
+// and calls notify with the sys_ids of events about table. notify reports whether a new
+// resync was queued (false when coalesced into a pending one).
+func WebhookHandler(secret, table string, notify func(ids ...string) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookBody+1))
+		if err != nil || len(body) > maxWebhookBody {
+			webhookEvents.WithLabelValues("invalid").Inc()
+			http.Error(w, "unreadable or oversized body", http.StatusBadRequest)
+			return
+		}
+		ts := req.Header.Get(TimestampHeader)
+		if !validSignature(secret, ts, body, req.Header.Get(SignatureHeader)) {
+			webhookEvents.WithLabelValues("unauthorized").Inc()
+			slog.Warn("servicenow webhook with invalid signature", "remote", req.RemoteAddr)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if !freshTimestamp(ts, time.Now()) {
+			webhookEvents.WithLabelValues("unauthorized").Inc()
+			slog.Warn("servicenow webhook outside the timestamp window", "remote", req.RemoteAddr, "timestamp", ts)
+			http.Error(w, "stale or missing timestamp", http.StatusUnauthorized)
+			return
+		}
+		events, err := decodeEvents(body)
+		if err != nil {
+			webhookEvents.WithLabelValues("invalid").Inc()
+			http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var ids []string
+		for _, ev := range events {
+			if ev.SysID == "" || (ev.Table != "" && ev.Table != table) {
+				webhookEvents.WithLabelValues("ignored").Inc()
+				continue
+			}
+			if !ValidSysID(ev.SysID) {
+				webhookEvents.WithLabelValues("invalid").Inc()
+				slog.Warn("servicenow change notification with invalid sys_id", "table", ev.Table, "sys_id", ev.SysID)
+				continue
+			}
+			slog.Info("servicenow change notification", "table", ev.Table, "operation", ev.Operation, "sys_id", ev.SysID)
+			ids = append(ids, ev.SysID)
+		}
+		if len(ids) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		queued := notify(ids...)
+		result := "queued"
+		if !queued {
+			result = "coalesced"
+		}
+		webhookEvents.WithLabelValues(result).Add(float64(len(ids)))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]any{"queued": queued, "records": len(ids)})
+	})
+}
+
+func decodeEvents(body []byte) ([]Event, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var evs []Event
+		err := json.Unmarshal(body, &evs)
+		return evs, err
+	}
+	var ev Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, err
+	}
+	return []Event{ev}, nil
+}
+
+// validSignature checks sig against the HMAC-SHA256 of ts + "." + body. Hex and base64
+// encodings are accepted since ServiceNow's GlideCertificateEncryption.generateMac returns
+// base64.
+func validSignature(secret, ts string, body []byte, sig string) bool {
+	if secret == "" || ts == "" || sig == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	want := mac.Sum(nil)
+
+	sig = strings.TrimPrefix(strings.TrimSpace(sig), "sha256=")
+	if got, err := hex.DecodeString(sig); err == nil && hmac.Equal(got, want) {
+		return true
+	}
+	if got, err := base64.StdEncoding.DecodeString(sig); err == nil && hmac.Equal(got, want) {
+		return true
+	}
+	return false
+}
+
+// freshTimestamp reports whether ts, in Unix seconds, is within maxWebhookSkew of now.
+func freshTimestamp(ts string, now time.Time) bool {
+	sec, err := strconv.ParseInt(strings.TrimSpace(ts), 10, 64)
+	if err != nil {
+		return false
+	}
+	d := now.Sub(time.Unix(sec, 0))
+	return d <= maxWebhookSkew && d >= -maxWebhookSkew
+}
@@ -0,0 +1,110 @@
+package servicenow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(secret, ts, body string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + body))
+	return mac.Sum(nil)
+}
+
+func TestWebhookHandler(t *testing.T) {
+	var notified []string
+	h := WebhookHandler("s3cret", "cmdb_ci_server", func(ids ...string) bool {
+		notified = append(notified, ids...)
+		return true
+	})
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	send := func(body, sig string) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/servicenow", strings.NewReader(body))
+		req.Header.Set(TimestampHeader, now)
+		if sig != "" {
+			req.Header.Set(SignatureHeader, sig)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	body := `{"table":"cmdb_ci_server","operation":"update","sys_id":"0f1e2d3c4b5a69788796a5b4c3d2e1f0"}`
+	if code := send(body, ""); code != http.StatusUnauthorized {
+		t.Fatalf("unsigned: %d", code)
+	}
+	if code := send(body, "sha256="+hex.EncodeToString(sign("wrong", now, body))); code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret: %d", code)
+	}
+	if code := send(body, "sha256="+hex.EncodeToString(sign("s3cret", now, body))); code != http.StatusAccepted {
+		t.Fatalf("hex signature: %d", code)
+	}
+	// the timestamp is signed and must be recent: a captured notification cannot be replayed later
+	if code := send(body, hex.EncodeToString(sign("s3cret", "1700000000", body))); code != http.StatusUnauthorized {
+		t.Fatalf("signature over another timestamp: %d", code)
+	}
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/webhook/servicenow", strings.NewReader(body))
+	req.Header.Set(TimestampHeader, old)
+	req.Header.Set(SignatureHeader, hex.EncodeToString(sign("s3cret", old, body)))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("stale timestamp: %d", rec.Code)
+	}
+
+	batch := `[{"table":"cmdb_ci_server","sys_id":"aabbccddeeff00112233445566778899"},{"table":"cmdb_ci_netgear","sys_id":"zzz"}]`
+	if code := send(batch, base64.StdEncoding.EncodeToString(sign("s3cret", now, batch))); code != http.StatusAccepted {
+		t.Fatalf("base64 signature: %d", code)
+	}
+	if strings.Join(notified, ",") != "0f1e2d3c4b5a69788796a5b4c3d2e1f0,aabbccddeeff00112233445566778899" {
+		t.Fatalf("unexpected notifications %v", notified)
+	}
+
+	other := `{"table":"cmdb_ci_netgear","sys_id":"zzz"}`
+	if code := send(other, hex.EncodeToString(sign("s3cret", now, other))); code != http.StatusNoContent {
+		t.Fatalf("other table: %d", code)
+	}
+	// a sys_id that is not 32 hex characters never reaches the query
+	bad := `{"table":"cmdb_ci_server","sys_id":"x^NQsys_idISNOTEMPTY"}`
+	if code := send(bad, hex.EncodeToString(sign("s3cret", now, bad))); code != http.StatusNoContent || len(notified) != 2 {
+		t.Fatalf("invalid sys_id: %d, notified %v", code, notified)
+	}
+}
+
+func TestFetchByID_UsesConfiguredQuery(t *testing.T) {
+	const id = "0f1e2d3c4b5a69788796a5b4c3d2e1f0"
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query().Get("sysparm_query")
+		_, _ = w.Write([]byte(`{"result":[{"sys_id":"` + id + `","host_name":"web01","business_service_lane":"lane1"}]}`))
+	}))
+	defer srv.Close()
+	c := &Client{baseURL: srv.URL, table: "cmdb_ci_server", query: "operational_status=1^NQinstall_status=1", hostField: "host_name", laneField: "business_service_lane", pageSize: 10, client: srv.Client()}
+
+	entries, err := c.FetchByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every OR branch is scoped to the record
+	if gotQuery != "operational_status=1^sys_id="+id+"^NQinstall_status=1^sys_id="+id {
+		t.Fatalf("unexpected query %q", gotQuery)
+	}
+	if len(entries) != 1 || entries[0].ID != id || entries[0].Hostname != "web01" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	gotQuery = ""
+	if _, err := c.FetchByID(context.Background(), "abc^NQsys_idISNOTEMPTY"); err == nil || gotQuery != "" {
+		t.Fatalf("invalid sys_id queried: err=%v query=%q", err, gotQuery)
+	}
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -23,9 +27,18 @@ func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+func (d Duration) MarshalYAML() (any, error) {
+	return d.String(), nil
+}
+
 type DummyCMDBEntry struct {
 	Hostname            string `yaml:"hostname"`
-	BusinessServiceLane string `yaml:"businessServiceLane"`
+	BusinessServiceLane string `yaml:"businessServiceLane"` // may be comma-separated
+	// BusinessServiceLanes lists additional lanes; merged with BusinessServiceLane
+	BusinessServiceLanes []string `yaml:"businessServiceLanes"`
+	Environment          string   `yaml:"environment"`
+	OS                   string   `yaml:"os"`
+	IPAddress            string   `yaml:"ipAddress"`
 }
 
 type DummyCMDBConfig struct {
@@ -44,10 +57,15 @@ type ServiceNowConfig struct {
 	Query              string         `yaml:"query"`
 	HostnameField      string         `yaml:"hostnameField"`
 	LaneField          string         `yaml:"laneField"`
+	EnvironmentField   string         `yaml:"environmentField"`
+	OSField            string         `yaml:"osField"`
+	IPField            string         `yaml:"ipField"`
 	PageSize           int            `yaml:"pageSize"`
 	Timeout            Duration       `yaml:"timeout"`
 	InsecureSkipVerify bool           `yaml:"insecureSkipVerify"`
 	Auth               ServiceNowAuth `yaml:"auth"`
+	// WebhookSecret enables the change notification receiver (HMAC-SHA256 shared secret)
+	WebhookSecret string `yaml:"webhookSecret"`
 }
 
 type CMDBConfig struct {
@@ -56,18 +74,294 @@ type CMDBConfig struct {
 	ServiceNow ServiceNowConfig `yaml:"servicenow"`
 }
 
+// StanzaSettings are the serverclass.conf keys the tool manages on an owned stanza.
+// Unset fields are not managed.
+type StanzaSettings struct {
+	RestartSplunkd     *bool             `yaml:"restartSplunkd"`
+	StateOnClient      string            `yaml:"stateOnClient"`      // enabled|disabled|noop
+	MachineTypesFilter string            `yaml:"machineTypesFilter"` // e.g. linux-x86_64,windows-x64
+	FilterType         string            `yaml:"filterType"`         // whitelist|blacklist
+	Extra              map[string]string `yaml:"extra"`              // any other key -> value
+}
+
+// Keys renders the settings as serverclass.conf key/value pairs.
+func (s StanzaSettings) Keys() map[string]string {
+	out := map[string]string{}
+	for k, v := range s.Extra {
+		out[k] = v
+	}
+	if s.RestartSplunkd != nil {
+		out["restartSplunkd"] = fmt.Sprint(*s.RestartSplunkd)
+	}
+	if s.StateOnClient != "" {
+		out["stateOnClient"] = s.StateOnClient
+	}
+	if s.MachineTypesFilter != "" {
+		out["machineTypesFilter"] = s.MachineTypesFilter
+	}
+	if s.FilterType != "" {
+		out["filterType"] = s.FilterType
+	}
+	return out
+}
+
+func (s StanzaSettings) validate() error {
+	switch s.StateOnClient {
+	case "", "enabled", "disabled", "noop":
+	default:
+		return fmt.Errorf("invalid stateOnClient %q", s.StateOnClient)
+	}
+	switch s.FilterType {
+	case "", "whitelist", "blacklist":
+	default:
+		return fmt.Errorf("invalid filterType %q", s.FilterType)
+	}
+	return nil
+}
+
+// ManagedClass is a [serverClass:<name>] stanza owned by the tool, with its app sub-stanzas.
+type ManagedClass struct {
+	StanzaSettings `yaml:",inline"`
+	Apps           map[string]StanzaSettings `yaml:"apps"` // app -> [serverClass:<name>:app:<app>]
+}
+
+// ServerclassTarget is one serverclass.conf file (on one deployment server or app) and the
+// apps/classes it owns.
+type ServerclassTarget struct {
+	Name           string            `yaml:"name"` // defaults to path
+	Path           string            `yaml:"path"`
+	Backup         bool              `yaml:"backup"`
+	DryRun         bool              `yaml:"dryRun"` // in addition to global dryRun
+	AppClass       map[string]string `yaml:"appClass"`
+	AppDestination map[string]string `yaml:"appDestination"`
+	DryRunApps     []string          `yaml:"dryRunApps"`
+
+	TargetOptions `yaml:",inline"`
+}
+
+// TargetOptions are per-target settings shared by the single-target fields and targets.
+type TargetOptions struct {
+	// Classes lists serverClass stanzas whose settings and app sub-stanzas the tool owns.
+	Classes map[string]ManagedClass `yaml:"classes"`
+	// ManagedIndexBase is the first whitelist index owned by the tool (default 1000).
+	ManagedIndexBase int `yaml:"managedIndexBase"`
+	// WhitelistMode is "inline" (whitelist.N entries, default) or "pathname" (host list
+	// files referenced by whitelist.from_pathname).
+	WhitelistMode   string   `yaml:"whitelistMode"`
+	PathnameClasses []string `yaml:"pathnameClasses"` // limit pathname mode to these classes (default all)
+	HostListDir     string   `yaml:"hostListDir"`     // where host list files are written
+	HostListRef     string   `yaml:"hostListRef"`     // directory written into whitelist.from_pathname (default hostListDir)
+	// BackupDir holds timestamped backups (default: next to each file).
+	BackupDir       string          `yaml:"backupDir"`
+	BackupRetention BackupRetention `yaml:"backupRetention"`
+	// ReloadCommand makes the deployment server re-read serverclass.conf,
+	// e.g. ["/opt/splunk/bin/splunk", "reload", "deploy-server"].
+	ReloadCommand []string `yaml:"reloadCommand"`
+}
+
+type BackupRetention struct {
+	KeepLast      int `yaml:"keepLast"`      // keep at most N backups per file (0 = unlimited)
+	MaxAgeDays    int `yaml:"maxAgeDays"`    // delete backups older than D days (0 = forever)
+	CompressAfter int `yaml:"compressAfter"` // gzip backups older than the newest N (0 = never)
+}
+
 type ServerclassConfig struct {
+	// Single-target fields; used as the only target when Targets is empty.
 	Path           string            `yaml:"path"`
 	Backup         bool              `yaml:"backup"`
 	AppClass       map[string]string `yaml:"appClass"`
 	AppDestination map[string]string `yaml:"appDestination"`
 	DryRunApps     []string          `yaml:"dryRunApps"`
+	TargetOptions  `yaml:",inline"`
+
+	Targets []ServerclassTarget `yaml:"targets"`
+
+	// Lock is taken per target around each update cycle (and rollback restores).
+	Lock LockConfig `yaml:"lock"`
+}
+
+type LockConfig struct {
+	Wait       Duration `yaml:"wait"`       // wait this long for another instance (default 0: fail immediately)
+	StaleAfter Duration `yaml:"staleAfter"` // break locks older than this (default 0: only dead PIDs, on Unix)
+}
+
+// EffectiveTargets returns the configured targets, or the single-target fields as one target.
+func (s ServerclassConfig) EffectiveTargets() []ServerclassTarget {
+	if len(s.Targets) > 0 {
+		return s.Targets
+	}
+	if s.Path == "" {
+		return nil
+	}
+	return []ServerclassTarget{{
+		Name:           s.Path,
+		Path:           s.Path,
+		Backup:         s.Backup,
+		AppClass:       s.AppClass,
+		AppDestination: s.AppDestination,
+		DryRunApps:     s.DryRunApps,
+		TargetOptions:  s.TargetOptions,
+	}}
 }
 
 type WildcardConfig struct {
-	Mode                  string `yaml:"mode"`                  // "trailingOnly" | "internalNumeric"
+	Mode                  string `yaml:"mode"`                  // "trailingOnly" | "internalNumeric" | "tokenized" | "exact"
 	MinGroupSize          int    `yaml:"minGroupSize"`          // default 2
 	RequireMinFixedPrefix int    `yaml:"requireMinFixedPrefix"` // default 0
+	MaxPatterns           int    `yaml:"maxPatterns"`           // budget per class: patterns are generalized to fit, warn if they cannot (0 = unlimited)
+
+	// tokenized mode: hostnames are split on any of Separators (default "-.")
+	Separators       string `yaml:"separators"`
+	WholeTokens      bool   `yaml:"wholeTokens"`      // also replace whole tokens by '*', not only trailing digits
+	MaxVaryingTokens int    `yaml:"maxVaryingTokens"` // token positions one pattern may generalize (default 1)
+
+	// Destinations and Classes override the settings above per destination key or server
+	// class name; a class override wins over its destination's.
+	Destinations map[string]WildcardOptions `yaml:"destinations"`
+	Classes      map[string]WildcardOptions `yaml:"classes"`
+}
+
+// WildcardOptions override the global wildcard settings; unset fields are inherited.
+type WildcardOptions struct {
+	Mode                  string `yaml:"mode"`
+	MinGroupSize          int    `yaml:"minGroupSize"`
+	RequireMinFixedPrefix *int   `yaml:"requireMinFixedPrefix"`
+	MaxPatterns           *int   `yaml:"maxPatterns"`
+	Separators            string `yaml:"separators"`
+	WholeTokens           *bool  `yaml:"wholeTokens"`
+	MaxVaryingTokens      int    `yaml:"maxVaryingTokens"`
+}
+
+// apply returns w with the options set in o.
+func (o WildcardOptions) apply(w WildcardConfig) WildcardConfig {
+	if o.Mode != "" {
+		w.Mode = o.Mode
+	}
+	if o.MinGroupSize > 0 {
+		w.MinGroupSize = o.MinGroupSize
+	}
+	if o.RequireMinFixedPrefix != nil {
+		w.RequireMinFixedPrefix = *o.RequireMinFixedPrefix
+	}
+	if o.MaxPatterns != nil {
+		w.MaxPatterns = *o.MaxPatterns
+	}
+	if o.Separators != "" {
+		w.Separators = o.Separators
+	}
+	if o.WholeTokens != nil {
+		w.WholeTokens = *o.WholeTokens
+	}
+	if o.MaxVaryingTokens > 0 {
+		w.MaxVaryingTokens = o.MaxVaryingTokens
+	}
+	return w
+}
+
+// For returns the effective settings for a server class fed by dest: the global block,
+// then the destination's overrides, then the class's. The result has no overrides.
+func (w WildcardConfig) For(dest, class string) WildcardConfig {
+	eff := w
+	eff.Destinations, eff.Classes = nil, nil
+	if o, ok := w.Destinations[dest]; ok {
+		eff = o.apply(eff)
+	}
+	if o, ok := w.Classes[class]; ok {
+		eff = o.apply(eff)
+	}
+	return eff
+}
+
+// validWildcardModes are the pattern generation modes.
+var validWildcardModes = map[string]bool{"trailingOnly": true, "internalNumeric": true, "tokenized": true, "exact": true}
+
+func (w WildcardConfig) validate() error {
+	check := func(where string, mode string, maxPatterns *int) error {
+		if mode != "" && !validWildcardModes[mode] {
+			return fmt.Errorf("wildcard%s: invalid mode %q", where, mode)
+		}
+		if maxPatterns != nil && *maxPatterns < 0 {
+			return fmt.Errorf("wildcard%s: maxPatterns must not be negative", where)
+		}
+		return nil
+	}
+	if err := check("", w.Mode, &w.MaxPatterns); err != nil {
+		return err
+	}
+	for dest, o := range w.Destinations {
+		if err := check(" destination "+dest, o.Mode, o.MaxPatterns); err != nil {
+			return err
+		}
+	}
+	for class, o := range w.Classes {
+		if err := check(" class "+class, o.Mode, o.MaxPatterns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MatchConfig describes a routing condition on CMDB entry attributes.
+// All populated fields must match (AND); All/Any/Not allow nesting.
+// An empty MatchConfig matches every entry.
+type MatchConfig struct {
+	Lane        []string      `yaml:"lane"`        // any of these lanes (case-insensitive)
+	Environment []string      `yaml:"environment"` // any of these environments (case-insensitive)
+	OS          []string      `yaml:"os"`          // any of these OS values (case-insensitive)
+	Hostname    string        `yaml:"hostname"`    // regular expression on hostname
+	CIDR        []string      `yaml:"cidr"`        // IP address within any of these networks
+	All         []MatchConfig `yaml:"all"`         // every sub-condition must match
+	Any         []MatchConfig `yaml:"any"`         // at least one sub-condition must match
+	Not         *MatchConfig  `yaml:"not"`         // sub-condition must not match
+}
+
+type RoutingRule struct {
+	Name         string      `yaml:"name"`
+	Priority     int         `yaml:"priority"` // higher is evaluated first; ties keep config order
+	Match        MatchConfig `yaml:"match"`
+	Destinations []string    `yaml:"destinations"`
+	Final        bool        `yaml:"final"` // stop evaluating lower-priority rules once matched
+}
+
+type RoutingConfig struct {
+	Rules []RoutingRule `yaml:"rules"`
+}
+
+// HTTPConfig configures the optional HTTP listener of the long-running mode.
+type HTTPConfig struct {
+	Listen string `yaml:"listen"` // e.g. ":9273"; empty disables the listener
+	// StaleCycles × refreshInterval: max age of the last successful cycle for /readyz and
+	// max run time of one cycle for /healthz (default 3)
+	StaleCycles int `yaml:"staleCycles"`
+	History     int `yaml:"history"` // runs kept for /api/runs (default 20)
+	// TriggerToken is the bearer token for POST /api/sync; empty disables the endpoint
+	TriggerToken string `yaml:"triggerToken"`
+}
+
+// DeploymentServerConfig is an optional source of the clients that phone home to the
+// deployment server, reconciled against the CMDB by the reconcile command. Set URL to
+// query the REST API or File to read an export of it.
+type DeploymentServerConfig struct {
+	URL                string               `yaml:"url"`  // management URL, e.g. https://ds01.example.com:8089
+	File               string               `yaml:"file"` // JSON export of services/deployment/server/clients
+	Timeout            Duration             `yaml:"timeout"`
+	InsecureSkipVerify bool                 `yaml:"insecureSkipVerify"`
+	Auth               DeploymentServerAuth `yaml:"auth"`
+	// StaleAfter: clients that have not phoned home for this long count as silent (default 24h)
+	StaleAfter Duration `yaml:"staleAfter"`
+}
+
+// DeploymentServerAuth authenticates against the splunkd management port: username and
+// password (basic auth) or a bearer token (a Splunk authentication token).
+type DeploymentServerAuth struct {
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	BearerToken string `yaml:"bearerToken"`
+}
+
+// AuditConfig configures the append-only audit log of serverclass changes.
+type AuditConfig struct {
+	File string `yaml:"file"` // JSON Lines file; empty disables the audit log
 }
 
 type LoggingConfig struct {
@@ -85,12 +379,89 @@ type Config struct {
 	RefreshInterval Duration            `yaml:"refreshInterval"`
 	DryRun          bool                `yaml:"dryRun"`
 	Destinations    map[string][]string `yaml:"destinations"`
+	Routing         RoutingConfig       `yaml:"routing"`
 	// Deprecated: use CMDB
 	DummyCMDB   DummyCMDBConfig   `yaml:"dummyCMDB"`
 	CMDB        CMDBConfig        `yaml:"cmdb"`
 	Serverclass ServerclassConfig `yaml:"serverclass"`
 	Wildcard    WildcardConfig    `yaml:"wildcard"`
 	Logging     LoggingConfig     `yaml:"logging"`
+	HTTP        HTTPConfig        `yaml:"http"`
+	Audit       AuditConfig       `yaml:"audit"`
+	// DeploymentServer is the optional phone-home source for the reconcile command
+	DeploymentServer DeploymentServerConfig `yaml:"deploymentServer"`
+}
+
+// knownDestination reports whether dest is a destination key or the target of a routing rule.
+func (c Config) knownDestination(dest string) bool {
+	if _, ok := c.Destinations[dest]; ok {
+		return true
+	}
+	for _, rule := range c.Routing.Rules {
+		for _, d := range rule.Destinations {
+			if d == dest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Redacted is used in place of secrets by Config.Redacted.
+const Redacted = "REDACTED"
+
+// Redacted returns a copy of the config with secrets replaced, safe to expose.
+func (c Config) Redacted() Config {
+	redact := func(s *string) {
+		if *s != "" {
+			*s = Redacted
+		}
+	}
+	redact(&c.CMDB.ServiceNow.Auth.Password)
+	redact(&c.CMDB.ServiceNow.Auth.BearerToken)
+	redact(&c.HTTP.TriggerToken)
+	redact(&c.CMDB.ServiceNow.WebhookSecret)
+	redact(&c.DeploymentServer.Auth.Password)
+	redact(&c.DeploymentServer.Auth.BearerToken)
+	// copies, so the caller's slices keep their values
+	c.Serverclass.ReloadCommand = redactCommand(c.Serverclass.ReloadCommand)
+	c.Serverclass.Targets = append([]ServerclassTarget(nil), c.Serverclass.Targets...)
+	for i := range c.Serverclass.Targets {
+		c.Serverclass.Targets[i].ReloadCommand = redactCommand(c.Serverclass.Targets[i].ReloadCommand)
+	}
+	return c
+}
+
+// redactCommand returns a copy of a command line with the credentials given to -auth
+// (as in "splunk reload deploy-server -auth admin:changeme") replaced.
+func redactCommand(cmd []string) []string {
+	if cmd == nil {
+		return nil
+	}
+	out := append([]string(nil), cmd...)
+	for i, arg := range out {
+		name, _, inline := strings.Cut(arg, "=")
+		if name != "-auth" && name != "--auth" {
+			continue
+		}
+		if inline {
+			out[i] = name + "=" + Redacted
+		} else if i+1 < len(out) {
+			out[i+1] = Redacted
+		}
+	}
+	return out
+}
+
+// Hash identifies the effective configuration (secrets excluded): the first 16 hex digits
+// of the SHA-256 of its YAML rendering.
+func (c Config) Hash() string {
+	b, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
 }
 
 func Load(path string) (*Config, error) {
@@ -122,6 +493,88 @@ func Load(path string) (*Config, error) {
 			cfg.CMDB.ServiceNow.Timeout = Duration{Duration: 30 * time.Second}
 		}
 	}
+	if ds := &cfg.DeploymentServer; ds.URL != "" || ds.File != "" {
+		if ds.URL != "" && ds.File != "" {
+			return nil, fmt.Errorf("deploymentServer: url and file are mutually exclusive")
+		}
+		if ds.Timeout.Duration == 0 {
+			ds.Timeout = Duration{Duration: 30 * time.Second}
+		}
+		if ds.StaleAfter.Duration == 0 {
+			ds.StaleAfter = Duration{Duration: 24 * time.Hour}
+		}
+	}
+	// Serverclass targets
+	seenPaths := map[string]string{}
+	for i := range cfg.Serverclass.Targets {
+		t := &cfg.Serverclass.Targets[i]
+		if t.Path == "" {
+			return nil, fmt.Errorf("serverclass target %d: path is required", i)
+		}
+		if t.Name == "" {
+			t.Name = t.Path
+		}
+		if other, ok := seenPaths[t.Path]; ok {
+			return nil, fmt.Errorf("serverclass targets %q and %q share path %s", other, t.Name, t.Path)
+		}
+		seenPaths[t.Path] = t.Name
+	}
+	// backups and host lists are found by name in their directory: targets sharing one
+	// would prune, list and restore each other's files
+	dirOwner, backupOwner := map[string]string{}, map[string]string{}
+	claimDir := func(t ServerclassTarget, what, dir string) error {
+		dir = filepath.Clean(dir)
+		if other, ok := dirOwner[dir]; ok && other != t.Name {
+			return fmt.Errorf("serverclass targets %q and %q share %s %s", other, t.Name, what, dir)
+		}
+		dirOwner[dir] = t.Name
+		return nil
+	}
+	for _, t := range cfg.Serverclass.EffectiveTargets() {
+		if t.BackupDir != "" {
+			if err := claimDir(t, "backupDir", t.BackupDir); err != nil {
+				return nil, err
+			}
+		}
+		if t.WhitelistMode == "pathname" && t.HostListDir != "" {
+			if err := claimDir(t, "hostListDir", t.HostListDir); err != nil {
+				return nil, err
+			}
+		}
+		dir := t.BackupDir
+		if dir == "" {
+			dir = filepath.Dir(t.Path)
+		}
+		base := filepath.Join(dir, filepath.Base(t.Path))
+		if other, ok := backupOwner[base]; ok {
+			return nil, fmt.Errorf("serverclass targets %q and %q would both back up to %s.*", other, t.Name, base)
+		}
+		backupOwner[base] = t.Name
+	}
+	for _, t := range cfg.Serverclass.EffectiveTargets() {
+		switch t.WhitelistMode {
+		case "", "inline":
+		case "pathname":
+			if t.HostListDir == "" {
+				return nil, fmt.Errorf("serverclass target %s: whitelistMode pathname requires hostListDir", t.Name)
+			}
+		default:
+			return nil, fmt.Errorf("serverclass target %s: invalid whitelistMode %q", t.Name, t.WhitelistMode)
+		}
+		if r := t.BackupRetention; r.KeepLast < 0 || r.MaxAgeDays < 0 || r.CompressAfter < 0 {
+			return nil, fmt.Errorf("serverclass target %s: backupRetention values must not be negative", t.Name)
+		}
+		for name, c := range t.Classes {
+			if err := c.validate(); err != nil {
+				return nil, fmt.Errorf("serverclass class %s: %w", name, err)
+			}
+			for app, a := range c.Apps {
+				if err := a.validate(); err != nil {
+					return nil, fmt.Errorf("serverclass class %s app %s: %w", name, app, err)
+				}
+			}
+		}
+	}
 	// Wildcard defaults
 	if cfg.Wildcard.Mode == "" {
 		cfg.Wildcard.Mode = "trailingOnly"
@@ -132,6 +585,14 @@ func Load(path string) (*Config, error) {
 	if cfg.Wildcard.RequireMinFixedPrefix < 0 {
 		cfg.Wildcard.RequireMinFixedPrefix = 0
 	}
+	if err := cfg.Wildcard.validate(); err != nil {
+		return nil, err
+	}
+	for dest := range cfg.Wildcard.Destinations {
+		if !cfg.knownDestination(dest) {
+			return nil, fmt.Errorf("wildcard destination %s: no such destination", dest)
+		}
+	}
 	// Logging defaults
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = "info"
@@ -0,0 +1,192 @@
+// Package dsclients reads the clients that phone home to a Splunk deployment server and
+// reconciles them with the CMDB.
+package dsclients
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/config"
+)
+
+// Client is one deployment client as known to the deployment server.
+type Client struct {
+	GUID          string    `json:"guid"`
+	ClientName    string    `json:"clientName"`
+	Hostname      string    `json:"hostname"`
+	DNS           string    `json:"dns"`
+	IP            string    `json:"ip"`
+	LastPhoneHome time.Time `json:"lastPhoneHome"`
+}
+
+// Names returns every name the deployment server matches whitelists against.
+func (c Client) Names() []string {
+	var out []string
+	for _, n := range []string{c.ClientName, c.Hostname, c.DNS, c.IP} {
+		if n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Source lists deployment clients.
+type Source interface {
+	Clients(ctx context.Context) ([]Client, error)
+}
+
+// ErrNotConfigured is returned by New when neither url nor file is set.
+var ErrNotConfigured = errors.New("deploymentServer.url or deploymentServer.file is not configured")
+
+// New returns the REST or file source configured in cfg.
+func New(cfg config.DeploymentServerConfig) (Source, error) {
+	switch {
+	case cfg.URL != "":
+		tr := &http.Transport{}
+		if cfg.InsecureSkipVerify {
+			tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // for labs only
+		}
+		return &restSource{baseURL: cfg.URL, auth: cfg.Auth, client: &http.Client{Transport: tr, Timeout: cfg.Timeout.Duration}}, nil
+	case cfg.File != "":
+		return &fileSource{path: cfg.File, fs: afero.NewOsFs()}, nil
+	default:
+		return nil, ErrNotConfigured
+	}
+}
+
+// restSource queries services/deployment/server/clients on the management port.
+type restSource struct {
+	baseURL string
+	auth    config.DeploymentServerAuth
+	client  *http.Client
+}
+
+func (s *restSource) Clients(ctx context.Context) ([]Client, error) {
+	u, err := url.Parse(s.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/services/deployment/server/clients"
+	q := u.Query()
+	q.Set("output_mode", "json")
+	q.Set("count", "0") // all clients in one response
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.auth.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.auth.BearerToken)
+	} else if s.auth.Username != "" {
+		req.SetBasicAuth(s.auth.Username, s.auth.Password)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("deployment server http %d", resp.StatusCode)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+	return Parse(buf.Bytes())
+}
+
+// fileSource reads an export of the REST response.
+type fileSource struct {
+	path string
+	fs   afero.Fs
+}
+
+func (s *fileSource) Clients(context.Context) ([]Client, error) {
+	b, err := afero.ReadFile(s.fs, s.path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// NewFile returns a source reading path from fs (e.g. an in-memory FS in tests).
+func NewFile(fs afero.Fs, path string) Source {
+	return &fileSource{path: path, fs: fs}
+}
+
+// restClient is the content of one entry of the REST response.
+type restClient struct {
+	GUID          string          `json:"guid"`
+	ClientName    string          `json:"clientName"`
+	Hostname      string          `json:"hostname"`
+	DNS           string          `json:"dns"`
+	IP            string          `json:"ip"`
+	LastPhoneHome json.RawMessage `json:"lastPhoneHomeTime"`
+}
+
+// Parse decodes the JSON of services/deployment/server/clients?output_mode=json, or a
+// plain array of its entries' content objects.
+func Parse(b []byte) ([]Client, error) {
+	b = bytes.TrimSpace(b)
+	var contents []restClient
+	if len(b) > 0 && b[0] == '[' {
+		if err := json.Unmarshal(b, &contents); err != nil {
+			return nil, err
+		}
+	} else {
+		var resp struct {
+			Entry []struct {
+				Name    string     `json:"name"`
+				Content restClient `json:"content"`
+			} `json:"entry"`
+		}
+		if err := json.Unmarshal(b, &resp); err != nil {
+			return nil, err
+		}
+		for _, e := range resp.Entry {
+			if e.Content.GUID == "" {
+				e.Content.GUID = e.Name
+			}
+			contents = append(contents, e.Content)
+		}
+	}
+	out := make([]Client, 0, len(contents))
+	for _, c := range contents {
+		out = append(out, Client{
+			GUID:          c.GUID,
+			ClientName:    c.ClientName,
+			Hostname:      c.Hostname,
+			DNS:           c.DNS,
+			IP:            c.IP,
+			LastPhoneHome: epoch(c.LastPhoneHome),
+		})
+	}
+	return out, nil
+}
+
+// epoch reads a Unix time sent as a number or a numeric string; zero when absent.
+func epoch(raw json.RawMessage) time.Time {
+	s := strings.Trim(string(raw), `"`)
+	if s == "" || s == "null" {
+		return time.Time{}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(f), 0).UTC()
+}
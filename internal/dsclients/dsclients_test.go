@@ -0,0 +1,98 @@
+package dsclients
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+)
+
+const restResponse = `{"entry":[
+ {"name":"1111","content":{"clientName":"web01","hostname":"web01","dns":"web01.example.com","ip":"10.0.0.1","lastPhoneHomeTime":1760000000}},
+ {"name":"2222","content":{"hostname":"DB01.corp.example.com","dns":"db01.corp.example.com","ip":"10.0.0.99","lastPhoneHomeTime":"1760000000"}},
+ {"name":"3333","content":{"hostname":"app7","dns":"app7.example.com","ip":"10.0.0.3","lastPhoneHomeTime":1760000000}},
+ {"name":"4444","content":{"hostname":"rogue01","dns":"rogue01","ip":"10.9.9.9","lastPhoneHomeTime":1760000000}},
+ {"name":"5555","content":{"hostname":"old01","ip":"10.0.0.5","lastPhoneHomeTime":1750000000}}
+]}`
+
+func TestRESTSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/deployment/server/clients" || r.URL.Query().Get("output_mode") != "json" {
+			http.NotFound(w, r)
+			return
+		}
+		if u, p, _ := r.BasicAuth(); u != "admin" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(restResponse))
+	}))
+	defer srv.Close()
+
+	src, err := New(config.DeploymentServerConfig{URL: srv.URL, Auth: config.DeploymentServerAuth{Username: "admin", Password: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := src.Clients(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 5 || clients[0].GUID != "1111" || clients[1].LastPhoneHome != time.Unix(1760000000, 0).UTC() {
+		t.Fatalf("unexpected clients %+v", clients)
+	}
+
+	src, _ = New(config.DeploymentServerConfig{URL: srv.URL})
+	if _, err := src.Clients(context.Background()); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+}
+
+func TestFileSourcePlainArray(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	_ = afero.WriteFile(mem, "/clients.json", []byte(`[{"hostname":"web01","ip":"10.0.0.1"}]`), 0o644)
+	clients, err := NewFile(mem, "/clients.json").Clients(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 1 || clients[0].Hostname != "web01" || !clients[0].LastPhoneHome.IsZero() {
+		t.Fatalf("unexpected clients %+v", clients)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	clients, err := Parse([]byte(restResponse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []cmdb.Entry{
+		{Hostname: "WEB01", IPAddress: "10.0.0.1"},
+		{Hostname: "db01", IPAddress: "10.0.0.2"},
+		{Hostname: "app07", IPAddress: "10.0.0.3"},
+		{Hostname: "old01", IPAddress: "10.0.0.5"},
+		{Hostname: "ghost01", IPAddress: "10.0.0.6"},
+	}
+	now := time.Unix(1760000000, 0).Add(time.Hour)
+	rep := Reconcile(entries, clients, 24*time.Hour, now)
+
+	if len(rep.Unknown) != 1 || rep.Unknown[0].Hostname != "rogue01" {
+		t.Fatalf("unknown = %+v", rep.Unknown)
+	}
+	if len(rep.Silent) != 2 || rep.Silent[0].Host != "ghost01" || !rep.Silent[0].LastPhoneHome.IsZero() ||
+		rep.Silent[1].Host != "old01" || rep.Silent[1].LastPhoneHome.IsZero() {
+		t.Fatalf("silent = %+v", rep.Silent)
+	}
+	if len(rep.Mismatches) != 2 ||
+		rep.Mismatches[0].Host != "app07" || rep.Mismatches[0].LinkedBy != LinkedByIP ||
+		rep.Mismatches[1].Host != "db01" || rep.Mismatches[1].LinkedBy != LinkedByShortName {
+		t.Fatalf("mismatches = %+v", rep.Mismatches)
+	}
+	if rep.OK() {
+		t.Fatal("report should not be OK")
+	}
+}
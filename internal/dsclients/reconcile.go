@@ -0,0 +1,150 @@
+package dsclients
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+)
+
+// How a client was tied to a CMDB host whose name it does not carry.
+const (
+	LinkedByIP        = "ip"
+	LinkedByShortName = "shortName"
+)
+
+// Report is the result of reconciling deployment clients with the CMDB.
+type Report struct {
+	Clients int `json:"clients"`
+	Hosts   int `json:"hosts"`
+	// Unknown clients phone home but match no CMDB host.
+	Unknown []Client `json:"unknown"`
+	// Silent CMDB hosts never phoned home, or not within the stale period.
+	Silent []SilentHost `json:"silent"`
+	// Mismatches are clients tied to a CMDB host by IP address or short name although
+	// none of their names is the CMDB hostname, so patterns built from the CMDB miss them.
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+// SilentHost is a CMDB host without a recent phone home.
+type SilentHost struct {
+	Host          string    `json:"host"`
+	IP            string    `json:"ip,omitempty"`
+	LastPhoneHome time.Time `json:"lastPhoneHome,omitempty"` // zero: never seen
+}
+
+// Mismatch is a client whose names differ from its CMDB host's.
+type Mismatch struct {
+	Host     string `json:"host"`
+	LinkedBy string `json:"linkedBy"`
+	Client   Client `json:"client"`
+}
+
+// OK reports whether nothing needs attention.
+func (r Report) OK() bool {
+	return len(r.Unknown) == 0 && len(r.Silent) == 0 && len(r.Mismatches) == 0
+}
+
+// Reconcile ties every client to a CMDB host: by one of its names (client name, hostname,
+// DNS name) equal to the CMDB hostname, otherwise by IP address or by short name (first
+// DNS label) when that is unambiguous. Names are compared case-insensitively. A host
+// counts as silent when no client is tied to it or its clients last phoned home more
+// than staleAfter before now.
+func Reconcile(entries []cmdb.Entry, clients []Client, staleAfter time.Duration, now time.Time) Report {
+	hosts := map[string]string{} // lowercase hostname -> hostname
+	ips := map[string]string{}   // IP -> hostname
+	shorts := map[string][]string{}
+	ipOf := map[string]string{}
+	for _, e := range entries {
+		key := strings.ToLower(e.Hostname)
+		if _, ok := hosts[key]; ok {
+			continue
+		}
+		hosts[key] = e.Hostname
+		if e.IPAddress != "" {
+			ips[e.IPAddress] = e.Hostname
+			ipOf[e.Hostname] = e.IPAddress
+		}
+		short := shortName(key)
+		shorts[short] = append(shorts[short], e.Hostname)
+	}
+
+	rep := Report{Clients: len(clients), Hosts: len(hosts), Unknown: []Client{}, Silent: []SilentHost{}, Mismatches: []Mismatch{}}
+	lastSeen := map[string]time.Time{} // hostname -> latest phone home of its clients
+	seen := map[string]bool{}
+	tie := func(host string, c Client) {
+		seen[host] = true
+		if c.LastPhoneHome.After(lastSeen[host]) {
+			lastSeen[host] = c.LastPhoneHome
+		}
+	}
+	for _, c := range clients {
+		if host, ok := exactHost(hosts, c); ok {
+			tie(host, c)
+			continue
+		}
+		if host, ok := ips[c.IP]; ok && c.IP != "" {
+			tie(host, c)
+			rep.Mismatches = append(rep.Mismatches, Mismatch{Host: host, LinkedBy: LinkedByIP, Client: c})
+			continue
+		}
+		if host, ok := shortHost(shorts, c); ok {
+			tie(host, c)
+			rep.Mismatches = append(rep.Mismatches, Mismatch{Host: host, LinkedBy: LinkedByShortName, Client: c})
+			continue
+		}
+		rep.Unknown = append(rep.Unknown, c)
+	}
+
+	for _, host := range hosts {
+		switch last := lastSeen[host]; {
+		case !seen[host]:
+			rep.Silent = append(rep.Silent, SilentHost{Host: host, IP: ipOf[host]})
+		case !last.IsZero() && staleAfter > 0 && now.Sub(last) > staleAfter:
+			rep.Silent = append(rep.Silent, SilentHost{Host: host, IP: ipOf[host], LastPhoneHome: last})
+		}
+	}
+	sort.Slice(rep.Unknown, func(i, j int) bool { return displayName(rep.Unknown[i]) < displayName(rep.Unknown[j]) })
+	sort.Slice(rep.Silent, func(i, j int) bool { return rep.Silent[i].Host < rep.Silent[j].Host })
+	sort.Slice(rep.Mismatches, func(i, j int) bool { return rep.Mismatches[i].Host < rep.Mismatches[j].Host })
+	return rep
+}
+
+func exactHost(hosts map[string]string, c Client) (string, bool) {
+	for _, n := range []string{c.ClientName, c.Hostname, c.DNS} {
+		if host, ok := hosts[strings.ToLower(n)]; ok && n != "" {
+			return host, true
+		}
+	}
+	return "", false
+}
+
+func shortHost(shorts map[string][]string, c Client) (string, bool) {
+	for _, n := range []string{c.Hostname, c.DNS, c.ClientName} {
+		if n == "" {
+			continue
+		}
+		if hs := shorts[shortName(strings.ToLower(n))]; len(hs) == 1 {
+			return hs[0], true
+		}
+	}
+	return "", false
+}
+
+// shortName returns the first DNS label of name; IP addresses are returned unchanged.
+func shortName(name string) string {
+	if strings.Trim(name, "0123456789.") == "" {
+		return name
+	}
+	short, _, _ := strings.Cut(name, ".")
+	return short
+}
+
+// displayName is the most telling name of a client.
+func displayName(c Client) string {
+	if names := c.Names(); len(names) > 0 {
+		return names[0]
+	}
+	return c.GUID
+}
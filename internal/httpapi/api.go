@@ -0,0 +1,101 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// getOnly rejects anything but GET (and HEAD) on the read-only API.
+func getOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h(w, req)
+	}
+}
+
+func (s *server) status(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.runner.Status())
+}
+
+// runs returns the last runs, newest first; ?limit=N caps the count.
+func (s *server) runs(w http.ResponseWriter, req *http.Request) {
+	limit := 0
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, s.runner.History(limit))
+}
+
+// config returns the effective config with secrets redacted, using the YAML field names.
+func (s *server) config(w http.ResponseWriter, _ *http.Request) {
+	if s.opts.Config == nil {
+		writeError(w, http.StatusNotFound, "config not available")
+		return
+	}
+	b, err := yaml.Marshal(s.opts.Config.Redacted())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var doc any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// whitelist returns a class's computed and published whitelist: ?class=NAME[&target=NAME].
+func (s *server) whitelist(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	class := q.Get("class")
+	if class == "" {
+		writeError(w, http.StatusBadRequest, "class is required")
+		return
+	}
+	cw, err := s.runner.ClassWhitelist(q.Get("target"), class)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, cw)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// sync queues an immediate cycle. It requires "Authorization: Bearer <triggerToken>" and is
+// disabled when no token is configured. Triggers coalesce while a cycle is pending.
+func (s *server) sync(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.opts.TriggerToken == "" {
+		writeError(w, http.StatusForbidden, "trigger endpoint disabled (no triggerToken configured)")
+		return
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.TriggerToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+		return
+	}
+	queued := s.runner.Trigger("http " + req.RemoteAddr)
+	writeJSON(w, http.StatusAccepted, map[string]bool{"queued": queued})
+}
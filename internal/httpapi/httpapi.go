@@ -0,0 +1,155 @@
+// Package httpapi serves the daemon's HTTP endpoints: metrics, health probes and a
+// status API.
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+// DefaultStaleCycles is how many refresh intervals may pass without a successful cycle
+// before the daemon reports itself not ready.
+const DefaultStaleCycles = 3
+
+// Options configure the handler.
+type Options struct {
+	RefreshInterval time.Duration
+	// StaleCycles × RefreshInterval bounds both the age of the last successful cycle
+	// (readiness) and the run time of a single cycle (liveness).
+	StaleCycles int
+	// Config is served, redacted, by /api/config.
+	Config *config.Config
+	// TriggerToken authorizes POST /api/sync; empty disables it.
+	TriggerToken string
+	// ServiceNowWebhook, if set, receives change notifications at /webhook/servicenow.
+	ServiceNowWebhook http.Handler
+}
+
+type server struct {
+	runner  *runner.Runner
+	opts    Options
+	started time.Time
+	now     func() time.Time
+}
+
+// New returns the handler for all endpoints.
+func New(r *runner.Runner, opts Options) http.Handler {
+	if opts.StaleCycles <= 0 {
+		opts.StaleCycles = DefaultStaleCycles
+	}
+	s := &server{runner: r, opts: opts, started: time.Now(), now: time.Now}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/api/status", getOnly(s.status))
+	mux.HandleFunc("/api/runs", getOnly(s.runs))
+	mux.HandleFunc("/api/config", getOnly(s.config))
+	mux.HandleFunc("/api/whitelist", getOnly(s.whitelist))
+	mux.HandleFunc("/api/sync", s.sync)
+	if opts.ServiceNowWebhook != nil {
+		mux.Handle("/webhook/servicenow", opts.ServiceNowWebhook)
+	}
+	return mux
+}
+
+// check is one line of a probe result.
+type check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+type probeResult struct {
+	Status string        `json:"status"` // ok or fail
+	Checks []check       `json:"checks"`
+	Runner runner.Status `json:"runner"`
+}
+
+func (s *server) limit() time.Duration {
+	return time.Duration(s.opts.StaleCycles) * s.opts.RefreshInterval
+}
+
+// healthz fails only when the sync loop is wedged: a cycle has been running for longer
+// than the limit, or no cycle has finished for a refresh interval plus the limit.
+func (s *server) healthz(w http.ResponseWriter, _ *http.Request) {
+	st := s.runner.Status()
+	now := s.now()
+	c := check{Name: "loop", OK: true}
+	switch {
+	case st.Running != nil && now.Sub(st.Running.Start) > s.limit():
+		c.OK, c.Message = false, fmt.Sprintf("cycle running since %s", st.Running.Start.Format(time.RFC3339))
+	case st.Running == nil:
+		lastEnd := s.started
+		if st.Last != nil {
+			lastEnd = st.Last.End
+		}
+		if now.Sub(lastEnd) > s.opts.RefreshInterval+s.limit() {
+			c.OK, c.Message = false, fmt.Sprintf("no cycle since %s", lastEnd.Format(time.RFC3339))
+		}
+	}
+	writeProbe(w, []check{c}, st)
+}
+
+// readyz fails unless the last successful cycle is recent, the last CMDB fetch worked and
+// every target's serverclass.conf is writable.
+func (s *server) readyz(w http.ResponseWriter, _ *http.Request) {
+	st := s.runner.Status()
+	checks := []check{{Name: "lastSuccess", OK: true}}
+	switch {
+	case st.LastSuccess.IsZero():
+		checks[0].OK, checks[0].Message = false, "no successful cycle yet"
+	case s.now().Sub(st.LastSuccess) > s.limit():
+		checks[0].OK, checks[0].Message = false, fmt.Sprintf("last successful cycle at %s", st.LastSuccess.Format(time.RFC3339))
+	}
+
+	cmdbCheck := check{Name: "cmdb", OK: st.Last != nil && st.Last.CMDBError == ""}
+	if st.Last == nil {
+		cmdbCheck.Message = "not fetched yet"
+	} else if st.Last.CMDBError != "" {
+		cmdbCheck.Message = st.Last.CMDBError
+	}
+	checks = append(checks, cmdbCheck)
+
+	writable := s.runner.CheckWritable()
+	names := make([]string, 0, len(writable))
+	for name := range writable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := check{Name: "writable:" + name, OK: writable[name] == nil}
+		if err := writable[name]; err != nil {
+			c.Message = err.Error()
+		}
+		checks = append(checks, c)
+	}
+	writeProbe(w, checks, st)
+}
+
+func writeProbe(w http.ResponseWriter, checks []check, st runner.Status) {
+	res := probeResult{Status: "ok", Checks: checks, Runner: st}
+	code := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			res.Status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, res)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
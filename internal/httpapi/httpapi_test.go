@@ -0,0 +1,191 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+func newRunner(t *testing.T) *runner.Runner {
+	t.Helper()
+	r, _ := newRunnerConfig(t)
+	return r
+}
+
+func newRunnerConfig(t *testing.T) (*runner.Runner, *config.Config) {
+	t.Helper()
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}},
+		CMDB: config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: []config.DummyCMDBEntry{
+			{Hostname: "abc001", BusinessServiceLane: "lane1"},
+			{Hostname: "abc002", BusinessServiceLane: "lane1"},
+		}}, ServiceNow: config.ServiceNowConfig{Auth: config.ServiceNowAuth{Username: "svc", Password: "hunter2"}}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/ds/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1"},
+			AppDestination: map[string]string{"app1": "dest1"},
+			TargetOptions:  config.TargetOptions{ReloadCommand: []string{"splunk", "reload", "deploy-server", "-auth", "admin:changeme"}},
+		},
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	_ = mem.MkdirAll("/ds", 0o755)
+	for _, tg := range r.Targets() {
+		tg.Updater.SetFS(mem)
+	}
+	return r, cfg
+}
+
+func probe(t *testing.T, h http.Handler, path string) (int, probeResult) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var res probeResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s: %v\n%s", path, err, rec.Body.String())
+	}
+	return rec.Code, res
+}
+
+func TestProbes(t *testing.T) {
+	r := newRunner(t)
+	h := New(r, Options{RefreshInterval: time.Minute})
+
+	if code, _ := probe(t, h, "/healthz"); code != http.StatusOK {
+		t.Fatalf("healthz before first cycle: %d", code)
+	}
+	if code, res := probe(t, h, "/readyz"); code != http.StatusServiceUnavailable || res.Status != "fail" {
+		t.Fatalf("readyz before first cycle: %d %+v", code, res)
+	}
+
+	if err := r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	code, res := probe(t, h, "/readyz")
+	if code != http.StatusOK {
+		t.Fatalf("readyz after a successful cycle: %d %+v", code, res)
+	}
+	if res.Runner.Last == nil || res.Runner.Last.Entries != 2 {
+		t.Fatalf("last run not reported: %+v", res.Runner)
+	}
+}
+
+func TestHealthz_Wedged(t *testing.T) {
+	r := newRunner(t)
+	s := &server{runner: r, opts: Options{RefreshInterval: time.Minute, StaleCycles: 3}, started: time.Now()}
+	s.now = func() time.Time { return time.Now().Add(5 * time.Minute) }
+	rec := httptest.NewRecorder()
+	s.healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected wedged loop to fail liveness, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func get(t *testing.T, h http.Handler, path string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: %v\n%s", path, err, rec.Body.String())
+	}
+	return rec.Code
+}
+
+func TestStatusAPI(t *testing.T) {
+	r, cfg := newRunnerConfig(t)
+	h := New(r, Options{RefreshInterval: time.Minute, Config: cfg})
+	for i := 0; i < 2; i++ {
+		if err := r.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if body := rec.Body.String(); rec.Code != http.StatusOK ||
+		!strings.Contains(body, `camr_cycles_total{outcome="success"}`) || !strings.Contains(body, `camr_destination_hosts{destination="dest1"} 2`) {
+		t.Fatalf("metrics: %d\n%s", rec.Code, body)
+	}
+
+	var runs []runner.Run
+	if code := get(t, h, "/api/runs?limit=5", &runs); code != http.StatusOK || len(runs) != 2 {
+		t.Fatalf("runs: %d %+v", code, runs)
+	}
+	// newest first: the second run had nothing left to change
+	if len(runs[1].Changes) != 1 || runs[1].Changes[0].Added[0] != "abc*" || len(runs[0].Changes) != 0 {
+		t.Fatalf("unexpected changes: %+v", runs)
+	}
+	if runs[0].Destinations["dest1"] != (runner.DestinationStats{Hosts: 2, Patterns: 1}) {
+		t.Fatalf("unexpected destination stats: %+v", runs[0].Destinations)
+	}
+
+	var cw runner.ClassWhitelist
+	if code := get(t, h, "/api/whitelist?class=class1", &cw); code != http.StatusOK {
+		t.Fatalf("whitelist: %d", code)
+	}
+	if len(cw.Computed) != 1 || cw.Computed[0] != "abc*" || len(cw.Current) != 1 || cw.Destination != "dest1" {
+		t.Fatalf("unexpected whitelist: %+v", cw)
+	}
+	var e map[string]string
+	if code := get(t, h, "/api/whitelist?class=nope", &e); code != http.StatusNotFound {
+		t.Fatalf("unknown class: %d %v", code, e)
+	}
+
+	var doc map[string]any
+	if code := get(t, h, "/api/config", &doc); code != http.StatusOK {
+		t.Fatalf("config: %d", code)
+	}
+	auth := doc["cmdb"].(map[string]any)["servicenow"].(map[string]any)["auth"].(map[string]any)
+	if auth["password"] != config.Redacted || auth["username"] != "svc" {
+		t.Fatalf("secrets not redacted: %v", auth)
+	}
+	reload := doc["serverclass"].(map[string]any)["reloadCommand"].([]any)
+	if reload[4] != config.Redacted || reload[3] != "-auth" || cfg.Serverclass.ReloadCommand[4] != "admin:changeme" {
+		t.Fatalf("reloadCommand credentials not redacted (or redacted in place): %v", reload)
+	}
+}
+
+func TestSyncTrigger(t *testing.T) {
+	r := newRunner(t)
+	post := func(h http.Handler, auth string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/sync", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(New(r, Options{RefreshInterval: time.Minute}), "Bearer x"); code != http.StatusForbidden {
+		t.Fatalf("trigger without configured token: %d", code)
+	}
+	h := New(r, Options{RefreshInterval: time.Minute, TriggerToken: "s3cret"})
+	if code := post(h, "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %d", code)
+	}
+	if code := post(h, "Bearer s3cret"); code != http.StatusAccepted {
+		t.Fatalf("valid token: %d", code)
+	}
+	// a second trigger before the loop picks up the first is coalesced
+	if r.Trigger("test") {
+		t.Fatal("second pending trigger was not coalesced")
+	}
+	<-r.Triggers()
+	if !r.Trigger("test") {
+		t.Fatal("trigger not queued after the pending one was consumed")
+	}
+}
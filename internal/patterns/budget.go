@@ -0,0 +1,195 @@
+package patterns
+
+import (
+	"sort"
+	"strings"
+)
+
+// stem is one pattern (or exact host) of a whitelist being fitted to a budget.
+type stem struct {
+	text  string
+	hosts int // hosts it covers
+}
+
+// FitBudget compresses the patterns a mode generated for hosts to at most maxPatterns.
+// Groups of patterns sharing a prefix are replaced by prefix+"*", longest prefixes first
+// and, for one prefix length, the groups saving the most patterns first, stopping as soon
+// as the result fits. A prefix pattern is only used when it matches none of avoid (e.g.
+// the hosts of other destinations), covers at least MinGroupSize hosts and keeps
+// RequireMinFixedPrefix characters before its first '*'. In tokenized mode prefixes end
+// at the start of a token's trailing digits, or at a separator with WholeTokens, and a
+// pattern generalizes at most MaxVaryingTokens positions. Hostnames are compared
+// case-insensitively. ok is false when no safe generalization fits; the most compressed
+// safe set, never longer than pats, is returned then.
+func FitBudget(pats, hosts, avoid []string, maxPatterns int, opts Options) (out []string, ok bool) {
+	pats = exactHosts(pats)
+	if maxPatterns <= 0 || len(pats) <= maxPatterns {
+		return pats, true
+	}
+	if opts.MinGroupSize <= 0 {
+		opts.MinGroupSize = 2
+	}
+	minPrefix := opts.RequireMinFixedPrefix
+	if minPrefix < 1 {
+		minPrefix = 1 // never a bare "*"
+	}
+	cut := prefixCut(opts)
+
+	stems := make([]stem, 0, len(pats))
+	for _, p := range pats {
+		stems = append(stems, stem{text: p, hosts: coverage(p, hosts)})
+	}
+	avoidLower := make([]string, 0, len(avoid))
+	for _, a := range avoid {
+		avoidLower = append(avoidLower, strings.ToLower(a))
+	}
+	sort.Strings(avoidLower)
+	safe := func(pattern string) bool {
+		// only hosts starting with the fixed part can match
+		fixed, _, _ := strings.Cut(pattern, "*")
+		re := Compile(pattern)
+		for i := sort.SearchStrings(avoidLower, fixed); i < len(avoidLower) && strings.HasPrefix(avoidLower[i], fixed); i++ {
+			if re.MatchString(avoidLower[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	maxLen := 0
+	for _, s := range stems {
+		if len(s.text) > maxLen {
+			maxLen = len(s.text)
+		}
+	}
+	for l := maxLen; l >= minPrefix && len(stems) > maxPatterns; l-- {
+		groups := map[string][]int{}
+		for i, s := range stems {
+			if len(s.text) >= l && cut(s.text, l) {
+				key := strings.ToLower(s.text[:l])
+				groups[key] = append(groups[key], i)
+			}
+		}
+		type candidate struct {
+			pattern string
+			members []int
+			hosts   int
+		}
+		var cands []candidate
+		for key, members := range groups {
+			if len(members) < 2 {
+				continue
+			}
+			c := candidate{pattern: stems[members[0]].text[:l] + "*", members: members}
+			if strings.HasSuffix(key, "*") {
+				c.pattern = stems[members[0]].text[:l]
+			}
+			for _, i := range members {
+				c.hosts += stems[i].hosts
+			}
+			if c.hosts < opts.MinGroupSize || strings.IndexByte(c.pattern, '*') < minPrefix || !safe(strings.ToLower(c.pattern)) {
+				continue
+			}
+			cands = append(cands, c)
+		}
+		sort.Slice(cands, func(i, j int) bool {
+			if len(cands[i].members) != len(cands[j].members) {
+				return len(cands[i].members) > len(cands[j].members)
+			}
+			return cands[i].pattern < cands[j].pattern
+		})
+
+		merged := map[int]bool{}
+		var added []stem
+		count := len(stems)
+		for _, c := range cands {
+			if count <= maxPatterns {
+				break
+			}
+			added = append(added, stem{text: c.pattern, hosts: c.hosts})
+			for _, i := range c.members {
+				merged[i] = true
+			}
+			count -= len(c.members) - 1
+		}
+		if len(added) == 0 {
+			continue
+		}
+		for i, s := range stems {
+			if !merged[i] {
+				added = append(added, s)
+			}
+		}
+		stems = added
+	}
+	return render(stems), len(stems) <= maxPatterns
+}
+
+// prefixCut returns whether a pattern may be cut after its first l characters (and the
+// rest replaced by '*') under the mode's constraints.
+func prefixCut(opts Options) func(text string, l int) bool {
+	if opts.Mode != "tokenized" {
+		return func(string, int) bool { return true }
+	}
+	seps := opts.Separators
+	if seps == "" {
+		seps = DefaultSeparators
+	}
+	maxVarying := opts.MaxVaryingTokens
+	if maxVarying <= 0 {
+		maxVarying = 1
+	}
+	isSep := func(c byte) bool { return strings.IndexByte(seps, c) >= 0 }
+	return func(text string, l int) bool {
+		// every token of the generalized tail counts as a varying position
+		tail := 1
+		for i := l; i < len(text); i++ {
+			if isSep(text[i]) {
+				tail++
+			}
+		}
+		if strings.Count(text[:l], "*")+tail > maxVarying {
+			return false
+		}
+		if isSep(text[l-1]) {
+			return opts.WholeTokens
+		}
+		// inside a token: only where its trailing digits start
+		end := l
+		for end < len(text) && text[end] >= '0' && text[end] <= '9' {
+			end++
+		}
+		prev := text[l-1]
+		if end == l || prev >= '0' && prev <= '9' {
+			return false
+		}
+		return end == len(text) || isSep(text[end]) && opts.WholeTokens
+	}
+}
+
+// coverage counts the hosts matching pattern.
+func coverage(pattern string, hosts []string) int {
+	if !strings.Contains(pattern, "*") {
+		return 1
+	}
+	re := Compile(pattern)
+	n := 0
+	for _, h := range hosts {
+		if re.MatchString(h) {
+			n++
+		}
+	}
+	return n
+}
+
+func render(stems []stem) []string {
+	if len(stems) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(stems))
+	for _, s := range stems {
+		out = append(out, s.text)
+	}
+	sort.Strings(out)
+	return dedupe(out)
+}
@@ -0,0 +1,126 @@
+package patterns
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFitBudget(t *testing.T) {
+	var hosts []string
+	for i := 1; i <= 12; i++ {
+		hosts = append(hosts, fmt.Sprintf("web%02d", i))
+	}
+	hosts = append(hosts, "db01", "db02", "db03")
+	avoid := []string{"WEB13", "dbx01"}
+
+	// fits already: exact hostnames
+	got, ok := FitBudget(hosts, hosts, avoid, 20, Options{})
+	if !ok || len(got) != len(hosts) {
+		t.Fatalf("got %v ok=%v", got, ok)
+	}
+
+	// web1* would reach web13 of another destination: web10-web12 stay explicit
+	got, ok = FitBudget(hosts, hosts, avoid, 5, Options{})
+	if want := "db0*,web0*,web10,web11,web12"; !ok || strings.Join(got, ",") != want {
+		t.Fatalf("got %v ok=%v, want %s", got, ok, want)
+	}
+
+	// cannot fit safely: best effort, not ok
+	got, ok = FitBudget(hosts, hosts, avoid, 3, Options{})
+	if ok || len(got) != 5 {
+		t.Fatalf("expected the budget to be impossible, got %v ok=%v", got, ok)
+	}
+	for _, h := range hosts {
+		if !matchesAny(got, h) {
+			t.Fatalf("%s not covered by %v", h, got)
+		}
+	}
+	for _, a := range avoid {
+		if matchesAny(got, a) {
+			t.Fatalf("%s of another destination matched by %v", a, got)
+		}
+	}
+}
+
+func TestFitBudget_Guards(t *testing.T) {
+	hosts := []string{"a1", "a2", "b1", "b2"}
+	got, ok := FitBudget(hosts, hosts, nil, 2, Options{RequireMinFixedPrefix: 2})
+	if ok || len(got) != 4 {
+		t.Fatalf("prefix guard ignored: %v ok=%v", got, ok)
+	}
+	got, ok = FitBudget(hosts, hosts, nil, 2, Options{MinGroupSize: 3})
+	if ok || len(got) != 4 {
+		t.Fatalf("group size guard ignored: %v ok=%v", got, ok)
+	}
+	got, ok = FitBudget(hosts, hosts, nil, 2, Options{})
+	if !ok || strings.Join(got, ",") != "a*,b*" {
+		t.Fatalf("got %v ok=%v", got, ok)
+	}
+}
+
+func TestFitBudget_GeneralizesModeOutput(t *testing.T) {
+	hosts := []string{"web01", "web02", "web03", "wex01", "wex02", "wey01"}
+	pats := []string{"web*", "wex*", "wey01"} // trailingOnly
+	got, ok := FitBudget(pats, hosts, nil, 2, Options{})
+	if !ok || strings.Join(got, ",") != "we*" {
+		t.Fatalf("got %v ok=%v", got, ok)
+	}
+	// "we*" would reach wez01: the mode's patterns are kept, not exploded into hosts
+	got, ok = FitBudget(pats, hosts, []string{"wez01"}, 2, Options{})
+	if ok || strings.Join(got, ",") != "web*,wex*,wey01" {
+		t.Fatalf("got %v ok=%v", got, ok)
+	}
+}
+
+func TestFitBudget_TokenizedKeepsTokenBoundaries(t *testing.T) {
+	hosts := []string{"lon-prd-web01", "lon-prd-web02", "lon-prd-wex01", "lon-prd-wex02", "lon-prd-db01", "lon-dev-web01", "lon-dev-web02"}
+	opts := Options{Mode: "tokenized"}
+	pats := GenerateWildcardsWithOptions(hosts, opts)
+	if strings.Join(pats, ",") != "lon-dev-web*,lon-prd-db01,lon-prd-web*,lon-prd-wex*" {
+		t.Fatalf("unexpected mode output %v", pats)
+	}
+
+	// tokens are never cut ("lon-prd-w*"): without wholeTokens nothing fits
+	got, ok := FitBudget(pats, hosts, nil, 2, opts)
+	if ok || strings.Join(got, ",") != strings.Join(pats, ",") {
+		t.Fatalf("got %v ok=%v", got, ok)
+	}
+
+	// whole tokens may go, one position at a time
+	opts.WholeTokens = true
+	got, ok = FitBudget(pats, hosts, nil, 2, opts)
+	if !ok || strings.Join(got, ",") != "lon-dev-web*,lon-prd-*" {
+		t.Fatalf("got %v ok=%v", got, ok)
+	}
+	// "lon-*" would vary two tokens of lon-dev-web*
+	got, ok = FitBudget(pats, hosts, nil, 1, opts)
+	if ok || strings.Join(got, ",") != "lon-dev-web*,lon-prd-*" {
+		t.Fatalf("maxVaryingTokens ignored: %v ok=%v", got, ok)
+	}
+	opts.MaxVaryingTokens = 2
+	if got, ok = FitBudget(pats, hosts, nil, 1, opts); !ok || strings.Join(got, ",") != "lon-*" {
+		t.Fatalf("got %v ok=%v", got, ok)
+	}
+
+	// never reaching another destination's host
+	opts.MaxVaryingTokens = 0
+	got, ok = FitBudget(pats, hosts, []string{"LON-PRD-APP01"}, 2, opts)
+	if ok || strings.Join(got, ",") != strings.Join(pats, ",") {
+		t.Fatalf("got %v ok=%v", got, ok)
+	}
+	for _, h := range hosts {
+		if !matchesAny(got, h) {
+			t.Fatalf("%s not covered by %v", h, got)
+		}
+	}
+}
+
+func matchesAny(pats []string, host string) bool {
+	for _, p := range pats {
+		if Match(p, host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package patterns
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Match reports whether host matches pattern the way the deployment server evaluates a
+// whitelist or blacklist value; see Compile.
+func Match(pattern, host string) bool {
+	return Compile(pattern).MatchString(host)
+}
+
+// Compile translates a whitelist/blacklist value into the regular expression the
+// deployment server evaluates: '.' is literal, '*' matches any run of characters, other
+// regex syntax is kept, the whole name must match and matching is case-insensitive.
+// A value that is not a valid expression only matches itself literally.
+func Compile(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			b.WriteString(`\.`)
+		case r == '*':
+			b.WriteString(`.*`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if escaped {
+		b.WriteString(`\\`)
+	}
+	re, err := regexp.Compile(`(?i)^(?:` + b.String() + `)$`)
+	if err != nil {
+		re = regexp.MustCompile(`(?i)^` + regexp.QuoteMeta(pattern) + `$`)
+	}
+	return re
+}
@@ -0,0 +1,36 @@
+package patterns
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"abc*", "abc001", true},
+		{"abc*", "ABC001", true},
+		{"abc*", "xabc001", false},
+		{"abc001", "abc001", true},
+		{"abc001", "abc0012", false},
+		{"api*-us-east-*", "api01-us-east-001", true},
+		{"api*-us-east-*", "api01-us-west-001", false},
+		{"*web*", "lon-prd-web01", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYc0", false},
+		{"*", "", true},
+		{"", "", true},
+		{"", "a", false},
+		{"**x", "abx", true},
+		{"web0?.example.com", "web0.example.com", true}, // '?' keeps its regex meaning
+		{"web01.example.com", "web01xexample.com", false},
+		{"10.1.2.*", "10.1.2.33", true},
+		{"host[0-9]+", "host42", true},
+		{"host[0-9", "host[0-9", true}, // invalid expression: literal
+		{`web\d+`, "web01", true},
+	}
+	for _, c := range cases {
+		if got := Match(c.pattern, c.host); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.pattern, c.host, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package patterns
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultSeparators split hostnames into tokens in tokenized mode.
+const DefaultSeparators = "-."
+
+// tokItem is a host, or a pattern built from hosts, split into tokens.
+type tokItem struct {
+	tokens  []string
+	seps    []string // seps[i] follows tokens[i]
+	hosts   int
+	varying int // generalized token positions
+}
+
+func (t tokItem) String() string {
+	var b strings.Builder
+	for i, tok := range t.tokens {
+		b.WriteString(tok)
+		if i < len(t.seps) {
+			b.WriteString(t.seps[i])
+		}
+	}
+	return b.String()
+}
+
+// key identifies the items that may merge at position i: same separators and tokens
+// everywhere but at i, and as many generalized positions.
+func (t tokItem) key(i int, gen string) string {
+	var b strings.Builder
+	for j, tok := range t.tokens {
+		if j == i {
+			tok = gen
+		}
+		b.WriteString(tok)
+		b.WriteByte(0)
+		if j < len(t.seps) {
+			b.WriteString(t.seps[j])
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func tokenize(host, separators string) tokItem {
+	it := tokItem{hosts: 1}
+	start := 0
+	for i := 0; i < len(host); i++ {
+		if strings.IndexByte(separators, host[i]) >= 0 {
+			it.tokens = append(it.tokens, host[start:i])
+			it.seps = append(it.seps, host[i:i+1])
+			start = i + 1
+		}
+	}
+	it.tokens = append(it.tokens, host[start:])
+	return it
+}
+
+// genTokenized splits hostnames on separators and merges hosts (and then patterns) that
+// share every token but one: that token's trailing digits become '*' ("web01", "web02"
+// -> "web*"), or, with WholeTokens, the whole token does. A pattern generalizes at most
+// MaxVaryingTokens positions, so "lon-prd-web*" never widens into "lon-*-web*" by
+// default. Groups need MinGroupSize hosts and RequireMinFixedPrefix fixed characters.
+func genTokenized(hosts []string, opts Options) []string {
+	if len(hosts) == 0 {
+		return nil
+	}
+	seps := opts.Separators
+	if seps == "" {
+		seps = DefaultSeparators
+	}
+	maxVarying := opts.MaxVaryingTokens
+	if maxVarying <= 0 {
+		maxVarying = 1
+	}
+
+	var items []tokItem
+	for _, h := range exactHosts(hosts) {
+		items = append(items, tokenize(h, seps))
+	}
+	for changed := true; changed; {
+		changed = false
+		// rightmost positions first: they usually carry the node number
+		for pos := maxTokens(items) - 1; pos >= 0; pos-- {
+			var merged bool
+			if items, merged = mergeAt(items, pos, false, maxVarying, opts); merged {
+				changed = true
+			}
+			if opts.WholeTokens {
+				if items, merged = mergeAt(items, pos, true, maxVarying, opts); merged {
+					changed = true
+				}
+			}
+		}
+	}
+
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.String())
+	}
+	sort.Strings(out)
+	return dedupe(out)
+}
+
+// mergeAt merges the items that differ only at token pos, generalizing its trailing
+// digits (or the whole token when whole is set).
+func mergeAt(items []tokItem, pos int, whole bool, maxVarying int, opts Options) ([]tokItem, bool) {
+	groups := map[string][]int{}
+	var order []string
+	gens := map[string]string{}
+	for idx, it := range items {
+		if pos >= len(it.tokens) || it.varying >= maxVarying || strings.Contains(it.tokens[pos], "*") {
+			continue
+		}
+		gen := "*"
+		if !whole {
+			pfx, num := splitNumericSuffix(it.tokens[pos])
+			if num == "" {
+				continue
+			}
+			gen = pfx + "*"
+		}
+		k := it.key(pos, gen)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+			gens[k] = gen
+		}
+		groups[k] = append(groups[k], idx)
+	}
+
+	used := map[int]bool{}
+	var added []tokItem
+	for _, k := range order {
+		members := groups[k]
+		if len(members) < 2 {
+			continue
+		}
+		first := items[members[0]]
+		m := tokItem{
+			tokens:  append([]string(nil), first.tokens...),
+			seps:    first.seps,
+			varying: first.varying + 1,
+		}
+		m.tokens[pos] = gens[k]
+		for _, idx := range members {
+			m.hosts += items[idx].hosts
+		}
+		if m.hosts < opts.MinGroupSize || strings.IndexByte(m.String(), '*') < opts.RequireMinFixedPrefix {
+			continue
+		}
+		for _, idx := range members {
+			used[idx] = true
+		}
+		added = append(added, m)
+	}
+	if len(added) == 0 {
+		return items, false
+	}
+	out := added
+	for idx, it := range items {
+		if !used[idx] {
+			out = append(out, it)
+		}
+	}
+	return out, true
+}
+
+func maxTokens(items []tokItem) int {
+	n := 0
+	for _, it := range items {
+		if len(it.tokens) > n {
+			n = len(it.tokens)
+		}
+	}
+	return n
+}
@@ -0,0 +1,50 @@
+package patterns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateWildcards_Tokenized(t *testing.T) {
+	hosts := []string{
+		"lon-prd-web01", "lon-prd-web02", "lon-prd-web03",
+		"lon-dev-web01", "lon-dev-web02",
+		"lon-prd-db01",
+		"nyc-prd-web1.example.com", "nyc-prd-web2.example.com",
+	}
+	got := GenerateWildcardsWithOptions(hosts, Options{Mode: "tokenized", MinGroupSize: 2})
+	want := []string{"lon-dev-web*", "lon-prd-db01", "lon-prd-web*", "nyc-prd-web*.example.com"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v want %v", got, want)
+	}
+
+	// two varying tokens with whole-token generalization allowed
+	got = GenerateWildcardsWithOptions(hosts[:5], Options{Mode: "tokenized", MinGroupSize: 2, WholeTokens: true, MaxVaryingTokens: 2})
+	if strings.Join(got, ",") != "lon-*-web*" {
+		t.Fatalf("got %v want [lon-*-web*]", got)
+	}
+	// whole tokens alone still vary a single position
+	got = GenerateWildcardsWithOptions(hosts[:5], Options{Mode: "tokenized", MinGroupSize: 2, WholeTokens: true})
+	if strings.Join(got, ",") != "lon-dev-web*,lon-prd-web*" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestGenerateWildcards_Tokenized_Guards(t *testing.T) {
+	hosts := []string{"a-01", "a-02", "lon-web01", "lon-web02", "lon-web03"}
+	got := GenerateWildcardsWithOptions(hosts, Options{Mode: "tokenized", MinGroupSize: 3, RequireMinFixedPrefix: 3})
+	want := []string{"a-01", "a-02", "lon-web*"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	// custom separators: '_' splits, '-' does not
+	got = GenerateWildcardsWithOptions([]string{"lon_prd_web01", "lon_prd_web02"}, Options{Mode: "tokenized", Separators: "_"})
+	if strings.Join(got, ",") != "lon_prd_web*" {
+		t.Fatalf("got %v", got)
+	}
+	// hosts with a different shape never merge
+	got = GenerateWildcardsWithOptions([]string{"web01", "web-02"}, Options{Mode: "tokenized"})
+	if strings.Join(got, ",") != "web-02,web01" {
+		t.Fatalf("got %v", got)
+	}
+}
@@ -8,11 +8,19 @@ import (
 // GenerateWildcards compresses hostnames by finding common prefixes and replacing trailing numeric sequences with a '*'.
 // It returns deterministic, sorted patterns.
 func GenerateWildcards(hosts []string) []string {
+	return genTrailing(hosts, Options{MinGroupSize: 2})
+}
+
+// genTrailing groups hosts by the part before their trailing digits and emits prefix+"*"
+// for groups of at least MinGroupSize hosts whose prefix has RequireMinFixedPrefix
+// characters; other hosts are listed explicitly.
+func genTrailing(hosts []string, opts Options) []string {
 	if len(hosts) == 0 {
 		return nil
 	}
 	h := append([]string(nil), hosts...)
 	sort.Strings(h)
+	h = dedupe(h)
 
 	groups := map[string][]string{}
 	for _, host := range h {
@@ -27,17 +35,27 @@ func GenerateWildcards(hosts []string) []string {
 
 	var out []string
 	for key, items := range groups {
-		if len(items) >= 2 {
+		if len(items) >= opts.MinGroupSize && len(key) >= opts.RequireMinFixedPrefix {
 			// patternize
 			out = append(out, key+"*")
 		} else {
-			out = append(out, items[0])
+			out = append(out, items...)
 		}
 	}
 	sort.Strings(out)
 	return dedupe(out)
 }
 
+// exactHosts lists every host explicitly, sorted and without duplicates.
+func exactHosts(hosts []string) []string {
+	if len(hosts) == 0 {
+		return nil
+	}
+	out := append([]string(nil), hosts...)
+	sort.Strings(out)
+	return dedupe(out)
+}
+
 func splitNumericSuffix(s string) (prefix, numeric string) {
 	// find trailing digits
 	i := len(s)
@@ -64,12 +82,18 @@ func dedupe(in []string) []string {
 
 // Options controls wildcard generation behavior.
 type Options struct {
-	// Mode: "trailingOnly" (default) or "internalNumeric"
+	// Mode: "trailingOnly" (default), "internalNumeric", "tokenized" or "exact" (no wildcards)
 	Mode string
 	// MinGroupSize: minimum number of hosts required to emit a wildcard pattern
 	MinGroupSize int
 	// RequireMinFixedPrefix: minimum number of fixed characters before the first '*' when emitting patterns
 	RequireMinFixedPrefix int
+	// Separators split hostnames into tokens in tokenized mode (default DefaultSeparators)
+	Separators string
+	// WholeTokens lets tokenized mode replace a whole token by '*', not only its trailing digits
+	WholeTokens bool
+	// MaxVaryingTokens: token positions a tokenized pattern may generalize (default 1)
+	MaxVaryingTokens int
 }
 
 // GenerateWildcardsWithOptions supports advanced grouping, including internal numeric blocks.
@@ -88,10 +112,14 @@ func GenerateWildcardsWithOptions(hosts []string, opts Options) []string {
 	}
 
 	switch opts.Mode {
+	case "exact":
+		return exactHosts(hosts)
 	case "internalNumeric":
 		return genInternalNumeric(hosts, opts)
+	case "tokenized":
+		return genTokenized(hosts, opts)
 	default:
-		return GenerateWildcards(hosts)
+		return genTrailing(hosts, opts)
 	}
 }
 
@@ -144,11 +172,3 @@ func normalizeDigits(s string) string {
 func patternFromNormalized(norm string) string {
 	return strings.ReplaceAll(norm, "#", "*")
 }
-
-// Match checks if a hostname matches a simple wildcard pattern with a single '*' at the end.
-func Match(pattern, host string) bool {
-	if strings.HasSuffix(pattern, "*") {
-		return strings.HasPrefix(host, strings.TrimSuffix(pattern, "*"))
-	}
-	return pattern == host
-}
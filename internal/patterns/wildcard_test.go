@@ -1,6 +1,9 @@
 package patterns
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestGenerateWildcards(t *testing.T) {
 	hosts := []string{"abc001", "abc002", "xyz101"}
@@ -67,3 +70,28 @@ func TestGenerateWildcards_InternalNumeric_Deterministic(t *testing.T) {
 		t.Fatalf("nondeterministic: %v vs %v", got1, got2)
 	}
 }
+
+func TestGenerateWildcards_Exact(t *testing.T) {
+	hosts := []string{"abc002", "abc001", "abc001", "xyz101"}
+	got := GenerateWildcardsWithOptions(hosts, Options{Mode: "exact"})
+	want := []string{"abc001", "abc002", "xyz101"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v want %v", got, want)
+	}
+}
+
+func TestGenerateWildcards_TrailingOnly_ThresholdAndPrefix(t *testing.T) {
+	hosts := []string{"web01", "web02", "db01", "db02", "db03", "x1", "x2", "x3"}
+	got := GenerateWildcardsWithOptions(hosts, Options{Mode: "trailingOnly", MinGroupSize: 3, RequireMinFixedPrefix: 2})
+	// web has too few hosts, x too short a prefix
+	want := []string{"db*", "web01", "web02", "x1", "x2", "x3"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	// defaults keep the historical behaviour
+	got = GenerateWildcardsWithOptions(hosts, Options{})
+	want = []string{"db*", "web*", "x*"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v want %v", got, want)
+	}
+}
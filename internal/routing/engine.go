@@ -0,0 +1,279 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+)
+
+// Engine assigns CMDB entries to destinations by evaluating prioritized rules.
+type Engine struct {
+	rules []rule
+}
+
+type rule struct {
+	name         string
+	priority     int
+	match        matcher
+	destinations []string
+	final        bool
+}
+
+// Step records the outcome of evaluating one rule against an entry.
+type Step struct {
+	Rule         string   `json:"rule"`
+	Priority     int      `json:"priority"`
+	Matched      bool     `json:"matched"`
+	Reason       string   `json:"reason"`
+	Destinations []string `json:"destinations,omitempty"`
+	Final        bool     `json:"final,omitempty"`
+}
+
+// Result is the routing decision for a single entry along with the trace that produced it.
+type Result struct {
+	Destinations []string `json:"destinations"`
+	Trace        []Step   `json:"trace"`
+}
+
+// New compiles the explicit rules plus the destination -> lanes shorthand into an Engine.
+// Shorthand entries become one priority-0 rule per destination, ordered by destination name.
+func New(cfg config.RoutingConfig, destinations map[string][]string) (*Engine, error) {
+	e := &Engine{}
+	for i, rc := range cfg.Rules {
+		name := rc.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+		if len(rc.Destinations) == 0 {
+			return nil, fmt.Errorf("routing rule %q: no destinations", name)
+		}
+		m, err := compile(rc.Match)
+		if err != nil {
+			return nil, fmt.Errorf("routing rule %q: %w", name, err)
+		}
+		e.rules = append(e.rules, rule{
+			name:         name,
+			priority:     rc.Priority,
+			match:        m,
+			destinations: append([]string(nil), rc.Destinations...),
+			final:        rc.Final,
+		})
+	}
+	dests := make([]string, 0, len(destinations))
+	for d := range destinations {
+		dests = append(dests, d)
+	}
+	sort.Strings(dests)
+	for _, d := range dests {
+		lanes := destinations[d]
+		if len(lanes) == 0 {
+			continue
+		}
+		e.rules = append(e.rules, rule{
+			name:         "destinations." + d,
+			match:        attrMatcher{attr: "lane", values: lanes},
+			destinations: []string{d},
+		})
+	}
+	// Higher priority first; stable so config order breaks ties.
+	sort.SliceStable(e.rules, func(i, j int) bool { return e.rules[i].priority > e.rules[j].priority })
+	return e, nil
+}
+
+// Route evaluates the rules against an entry. Every matching rule contributes its
+// destinations until a matching rule marked final is reached.
+func (e *Engine) Route(entry cmdb.Entry) Result {
+	var res Result
+	seen := map[string]bool{}
+	for _, r := range e.rules {
+		ok, reason := r.match.match(entry)
+		st := Step{Rule: r.name, Priority: r.priority, Matched: ok, Reason: reason}
+		if ok {
+			st.Destinations = r.destinations
+			st.Final = r.final
+			for _, d := range r.destinations {
+				if !seen[d] {
+					seen[d] = true
+					res.Destinations = append(res.Destinations, d)
+				}
+			}
+		}
+		res.Trace = append(res.Trace, st)
+		if ok && r.final {
+			break
+		}
+	}
+	sort.Strings(res.Destinations)
+	return res
+}
+
+type matcher interface {
+	match(e cmdb.Entry) (bool, string)
+}
+
+func compile(mc config.MatchConfig) (matcher, error) {
+	var all allMatcher
+	if len(mc.Lane) > 0 {
+		all = append(all, attrMatcher{attr: "lane", values: mc.Lane})
+	}
+	if len(mc.Environment) > 0 {
+		all = append(all, attrMatcher{attr: "environment", values: mc.Environment})
+	}
+	if len(mc.OS) > 0 {
+		all = append(all, attrMatcher{attr: "os", values: mc.OS})
+	}
+	if mc.Hostname != "" {
+		re, err := regexp.Compile(mc.Hostname)
+		if err != nil {
+			return nil, fmt.Errorf("hostname regex: %w", err)
+		}
+		all = append(all, hostnameMatcher{re: re})
+	}
+	if len(mc.CIDR) > 0 {
+		cm := cidrMatcher{}
+		for _, c := range mc.CIDR {
+			_, n, err := net.ParseCIDR(c)
+			if err != nil {
+				return nil, fmt.Errorf("cidr: %w", err)
+			}
+			cm.nets = append(cm.nets, n)
+		}
+		all = append(all, cm)
+	}
+	if len(mc.All) > 0 {
+		sub, err := compileList(mc.All)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, allMatcher(sub))
+	}
+	if len(mc.Any) > 0 {
+		sub, err := compileList(mc.Any)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, anyMatcher(sub))
+	}
+	if mc.Not != nil {
+		sub, err := compile(*mc.Not)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, notMatcher{m: sub})
+	}
+	if len(all) == 1 {
+		return all[0], nil
+	}
+	return all, nil
+}
+
+func compileList(list []config.MatchConfig) ([]matcher, error) {
+	out := make([]matcher, 0, len(list))
+	for _, mc := range list {
+		m, err := compile(mc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+type attrMatcher struct {
+	attr   string
+	values []string
+}
+
+func (m attrMatcher) match(e cmdb.Entry) (bool, string) {
+	var v string
+	switch m.attr {
+	case "lane":
+		// multi-valued: any of the entry's lanes may match
+		lanes := e.Lanes()
+		for _, l := range lanes {
+			for _, want := range m.values {
+				if strings.EqualFold(l, want) {
+					return true, fmt.Sprintf("lane %q in %v", l, m.values)
+				}
+			}
+		}
+		return false, fmt.Sprintf("lanes %v not in %v", lanes, m.values)
+	case "environment":
+		v = e.Environment
+	case "os":
+		v = e.OS
+	}
+	for _, want := range m.values {
+		if strings.EqualFold(v, want) {
+			return true, fmt.Sprintf("%s %q in %v", m.attr, v, m.values)
+		}
+	}
+	return false, fmt.Sprintf("%s %q not in %v", m.attr, v, m.values)
+}
+
+type hostnameMatcher struct{ re *regexp.Regexp }
+
+func (m hostnameMatcher) match(e cmdb.Entry) (bool, string) {
+	if m.re.MatchString(e.Hostname) {
+		return true, fmt.Sprintf("hostname %q matches /%s/", e.Hostname, m.re)
+	}
+	return false, fmt.Sprintf("hostname %q does not match /%s/", e.Hostname, m.re)
+}
+
+type cidrMatcher struct{ nets []*net.IPNet }
+
+func (m cidrMatcher) match(e cmdb.Entry) (bool, string) {
+	ip := net.ParseIP(strings.TrimSpace(e.IPAddress))
+	if ip == nil {
+		return false, fmt.Sprintf("ip %q is not a valid address", e.IPAddress)
+	}
+	for _, n := range m.nets {
+		if n.Contains(ip) {
+			return true, fmt.Sprintf("ip %s in %s", ip, n)
+		}
+	}
+	return false, fmt.Sprintf("ip %s not in %v", ip, m.nets)
+}
+
+type allMatcher []matcher
+
+func (m allMatcher) match(e cmdb.Entry) (bool, string) {
+	if len(m) == 0 {
+		return true, "no conditions"
+	}
+	reasons := make([]string, 0, len(m))
+	for _, sub := range m {
+		ok, r := sub.match(e)
+		if !ok {
+			return false, r
+		}
+		reasons = append(reasons, r)
+	}
+	return true, strings.Join(reasons, " and ")
+}
+
+type anyMatcher []matcher
+
+func (m anyMatcher) match(e cmdb.Entry) (bool, string) {
+	reasons := make([]string, 0, len(m))
+	for _, sub := range m {
+		ok, r := sub.match(e)
+		if ok {
+			return true, r
+		}
+		reasons = append(reasons, r)
+	}
+	return false, "none of: " + strings.Join(reasons, "; ")
+}
+
+type notMatcher struct{ m matcher }
+
+func (m notMatcher) match(e cmdb.Entry) (bool, string) {
+	ok, r := m.m.match(e)
+	return !ok, "not (" + r + ")"
+}
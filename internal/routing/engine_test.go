@@ -0,0 +1,107 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+)
+
+func TestRoute_DestinationsShorthand(t *testing.T) {
+	e, err := New(config.RoutingConfig{}, map[string][]string{
+		"dest1": {"lane1", "lane2"},
+		"dest2": {"lane3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := e.Route(cmdb.Entry{Hostname: "abc001", BusinessServiceLane: "lane2"})
+	if !reflect.DeepEqual(got.Destinations, []string{"dest1"}) {
+		t.Fatalf("got %v want [dest1]", got.Destinations)
+	}
+	if got := e.Route(cmdb.Entry{Hostname: "abc001", BusinessServiceLane: "lane9"}); len(got.Destinations) != 0 {
+		t.Fatalf("unknown lane should not route, got %v", got.Destinations)
+	}
+}
+
+func TestRoute_PriorityFinalAndCombinators(t *testing.T) {
+	cfg := config.RoutingConfig{Rules: []config.RoutingRule{
+		{
+			Name:     "pci",
+			Priority: 100,
+			Match: config.MatchConfig{
+				Any: []config.MatchConfig{
+					{CIDR: []string{"10.20.0.0/16"}},
+					{Hostname: "^pci-"},
+				},
+			},
+			Destinations: []string{"pci"},
+			Final:        true,
+		},
+		{
+			Name:         "prod-linux",
+			Priority:     10,
+			Match:        config.MatchConfig{Environment: []string{"prod"}, Not: &config.MatchConfig{OS: []string{"windows"}}},
+			Destinations: []string{"central"},
+		},
+	}}
+	e, err := New(cfg, map[string][]string{"regional": {"lane1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pci := e.Route(cmdb.Entry{Hostname: "db01", BusinessServiceLane: "lane1", Environment: "prod", IPAddress: "10.20.1.5"})
+	if !reflect.DeepEqual(pci.Destinations, []string{"pci"}) {
+		t.Fatalf("final rule should stop evaluation, got %v", pci.Destinations)
+	}
+	if len(pci.Trace) != 1 || !pci.Trace[0].Matched {
+		t.Fatalf("unexpected trace: %+v", pci.Trace)
+	}
+
+	both := e.Route(cmdb.Entry{Hostname: "web01", BusinessServiceLane: "lane1", Environment: "PROD", OS: "linux", IPAddress: "10.30.1.5"})
+	if !reflect.DeepEqual(both.Destinations, []string{"central", "regional"}) {
+		t.Fatalf("got %v want [central regional]", both.Destinations)
+	}
+	if len(both.Trace) != 3 {
+		t.Fatalf("expected all rules evaluated, trace: %+v", both.Trace)
+	}
+
+	win := e.Route(cmdb.Entry{Hostname: "win01", BusinessServiceLane: "lane1", Environment: "prod", OS: "Windows"})
+	if !reflect.DeepEqual(win.Destinations, []string{"regional"}) {
+		t.Fatalf("got %v want [regional]", win.Destinations)
+	}
+}
+
+func TestNew_InvalidRule(t *testing.T) {
+	_, err := New(config.RoutingConfig{Rules: []config.RoutingRule{
+		{Name: "bad", Match: config.MatchConfig{CIDR: []string{"10.0.0.0/99"}}, Destinations: []string{"d"}},
+	}}, nil)
+	if err == nil {
+		t.Fatal("expected error for invalid CIDR")
+	}
+	_, err = New(config.RoutingConfig{Rules: []config.RoutingRule{{Name: "empty"}}}, nil)
+	if err == nil {
+		t.Fatal("expected error for rule without destinations")
+	}
+}
+
+func TestRoute_MultiValuedLanes(t *testing.T) {
+	e, err := New(config.RoutingConfig{}, map[string][]string{
+		"regional": {"lane1"},
+		"central":  {"lane1", "lane2"},
+		"other":    {"lane3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := e.Route(cmdb.Entry{Hostname: "abc001", BusinessServiceLane: "lane2, lane3"})
+	if !reflect.DeepEqual(got.Destinations, []string{"central", "other"}) {
+		t.Fatalf("got %v want [central other]", got.Destinations)
+	}
+	// a lane listed under two destinations goes to both, in sorted order
+	got = e.Route(cmdb.Entry{Hostname: "abc002", BusinessServiceLane: "lane1"})
+	if !reflect.DeepEqual(got.Destinations, []string{"central", "regional"}) {
+		t.Fatalf("got %v want [central regional]", got.Destinations)
+	}
+}
@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/example/splunk-ds-camr/internal/audit"
+	"github.com/example/splunk-ds-camr/internal/patterns"
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+var auditErrors = promauto.NewCounter(prometheus.CounterOpts{Name: "camr_audit_errors_total",
+	Help: "Audit records that could not be written."})
+
+// AuditLog returns the audit log, or nil when auditing is disabled.
+func (r *Runner) AuditLog() *audit.Log { return r.audit }
+
+// writeAudit records a target's whitelist changes and corrected (or, in dry-run, proposed)
+// stanza drift. Failures are logged: the changes are already in place.
+func (r *Runner) writeAudit(t Target, run *Run, changes []serverclass.Change, drifts []serverclass.Drift, hosts, prevHosts map[string][]string) {
+	if r.audit == nil {
+		return
+	}
+	var recs []audit.Record
+	for _, d := range drifts {
+		if d.Unowned {
+			continue
+		}
+		d := d
+		recs = append(recs, audit.Record{
+			Time:       run.Start,
+			Kind:       audit.KindStanza,
+			Target:     t.Name,
+			File:       t.Updater.Path(),
+			Drift:      &d,
+			ConfigHash: r.configHash,
+			Snapshot:   run.Snapshot,
+			DryRun:     !d.Fixed,
+		})
+	}
+	for _, c := range changes {
+		dest := t.AppDestination[c.App]
+		rec := audit.Record{
+			Time:         c.Time,
+			Kind:         audit.KindWhitelist,
+			Target:       t.Name,
+			File:         c.File,
+			Class:        c.Class,
+			App:          c.App,
+			Destination:  dest,
+			Added:        c.Added,
+			Removed:      c.Removed,
+			AddedHosts:   coveredHosts(c.Added, hosts[dest]),
+			RemovedHosts: coveredHosts(c.Removed, prevHosts[dest]),
+			ConfigHash:   r.configHash,
+			Snapshot:     run.Snapshot,
+			Backups:      c.Backups,
+			DryRun:       c.DryRun,
+		}
+		if prevHosts != nil {
+			rec.HostsJoined, rec.HostsLeft = hostDiff(prevHosts[dest], hosts[dest])
+		}
+		recs = append(recs, rec)
+	}
+	if err := r.audit.Write(recs...); err != nil {
+		auditErrors.Add(float64(len(recs)))
+		slog.Error("audit log write failed", "file", r.audit.Path(), "records", len(recs), "err", err)
+	}
+}
+
+// newProposals drops the dry-run changes and stanza drifts that were already reported in
+// an earlier cycle with the same content, so the audit log and the dry-run preview only
+// show a proposal when it first appears or changes. Once a target's update completed,
+// proposals it no longer makes are forgotten and reported again should they come back.
+// Applied changes always pass; the memory does not survive a restart.
+func (r *Runner) newProposals(t Target, changes []serverclass.Change, drifts []serverclass.Drift, complete bool) ([]serverclass.Change, []serverclass.Drift) {
+	prev := r.proposed[t.Name]
+	seen := map[string]string{}
+	if !complete {
+		for k, v := range prev {
+			seen[k] = v
+		}
+	}
+	fresh := func(key, content string) bool {
+		seen[key] = content
+		old, ok := prev[key]
+		return !ok || old != content
+	}
+	var outChanges []serverclass.Change
+	for _, c := range changes {
+		if !c.DryRun || fresh("whitelist\x00"+c.Class+"\x00"+c.App,
+			strings.Join(c.Added, ",")+"\x00"+strings.Join(c.Removed, ",")) {
+			outChanges = append(outChanges, c)
+		}
+	}
+	var outDrifts []serverclass.Drift
+	for _, d := range drifts {
+		if d.Fixed || d.Unowned || fresh("stanza\x00"+d.Stanza+"\x00"+d.Key,
+			fmt.Sprintf("%q %q %t", d.Want, d.Got, d.Missing)) {
+			outDrifts = append(outDrifts, d)
+		}
+	}
+	if r.proposed == nil {
+		r.proposed = map[string]map[string]string{}
+	}
+	r.proposed[t.Name] = seen
+	return outChanges, outDrifts
+}
+
+// coveredHosts maps each pattern to the hosts it matches.
+func coveredHosts(pats, hosts []string) map[string][]string {
+	if len(pats) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(pats))
+	for _, p := range pats {
+		var matched []string
+		re := patterns.Compile(p)
+		for _, h := range hosts {
+			if re.MatchString(h) {
+				matched = append(matched, h)
+			}
+		}
+		sort.Strings(matched)
+		out[p] = matched
+	}
+	return out
+}
+
+// hostDiff returns the hosts only in cur (joined) and only in prev (left), sorted.
+func hostDiff(prev, cur []string) (joined, left []string) {
+	in := func(list []string) map[string]bool {
+		m := make(map[string]bool, len(list))
+		for _, h := range list {
+			m[h] = true
+		}
+		return m
+	}
+	prevSet, curSet := in(prev), in(cur)
+	for _, h := range cur {
+		if !prevSet[h] {
+			joined = append(joined, h)
+		}
+	}
+	for _, h := range prev {
+		if !curSet[h] {
+			left = append(left, h)
+		}
+	}
+	sort.Strings(joined)
+	sort.Strings(left)
+	return joined, left
+}
@@ -0,0 +1,169 @@
+package runner
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/patterns"
+	"github.com/example/splunk-ds-camr/internal/routing"
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+// Explanation traces one host through a sync cycle: CMDB records, routing and the classes
+// of each target that (should) whitelist it, with their generated patterns.
+type Explanation struct {
+	Host         string                   `json:"host"`
+	Records      []RecordExplanation      `json:"records"`
+	Destinations []DestinationExplanation `json:"destinations"`
+	Targets      []TargetExplanation      `json:"targets"`
+}
+
+// RecordExplanation is one CMDB record for the host and how it was routed.
+type RecordExplanation struct {
+	Entry cmdb.Entry     `json:"entry"`
+	Lanes []string       `json:"lanes"` // the lane field after splitting and trimming
+	Route routing.Result `json:"route"`
+}
+
+// DestinationExplanation is one destination the host is routed to.
+type DestinationExplanation struct {
+	Name  string `json:"name"`
+	Hosts int    `json:"hosts"` // hosts routed to the destination
+}
+
+// TargetExplanation compares expected and actual class membership in one target.
+type TargetExplanation struct {
+	Target  string             `json:"target"`
+	File    string             `json:"file"`
+	Paused  bool               `json:"paused,omitempty"`
+	Classes []ClassExplanation `json:"classes"`
+}
+
+// ClassExplanation is one class that should whitelist the host, or does.
+type ClassExplanation struct {
+	Class       string                    `json:"class"`
+	Apps        []string                  `json:"apps,omitempty"`
+	Destination string                    `json:"destination,omitempty"`
+	FilterType  string                    `json:"filterType,omitempty"`
+	Expected    bool                      `json:"expected"`           // the host is routed to the class's destination
+	Patterns    []string                  `json:"patterns,omitempty"` // the class's generated patterns matching the host
+	Whitelisted []serverclass.FilterEntry `json:"whitelisted,omitempty"`
+	Blacklisted []serverclass.FilterEntry `json:"blacklisted,omitempty"`
+	Unresolved  []string                  `json:"unresolved,omitempty"`
+}
+
+// Included reports whether the host currently gets the class.
+func (c ClassExplanation) Included() bool {
+	if c.FilterType == "blacklist" {
+		return len(c.Blacklisted) == 0 || len(c.Whitelisted) > 0
+	}
+	return len(c.Whitelisted) > 0 && len(c.Blacklisted) == 0
+}
+
+// Explain fetches the CMDB and traces host through the same routing and pattern
+// generation as RunOnce, then checks every target's current serverclass.conf.
+// Hostnames are compared case-insensitively.
+func (r *Runner) Explain(ctx context.Context, host string) (Explanation, error) {
+	entries, err := r.cmdb.Fetch(ctx)
+	if err != nil {
+		return Explanation{}, err
+	}
+	ex := Explanation{Host: host}
+	for _, e := range entries {
+		if strings.EqualFold(e.Hostname, host) {
+			ex.Records = append(ex.Records, RecordExplanation{Entry: e, Lanes: e.Lanes(), Route: r.router.Route(e)})
+		}
+	}
+
+	hostsByDest := r.hostsByDestination(entries)
+	patternsByDest := r.compress(hostsByDest)
+	routed := map[string]bool{}
+	for _, rec := range ex.Records {
+		for _, d := range rec.Route.Destinations {
+			routed[d] = true
+		}
+	}
+	for _, dest := range sortedKeys(routed) {
+		ex.Destinations = append(ex.Destinations, DestinationExplanation{Name: dest, Hosts: len(hostsByDest[dest])})
+	}
+
+	// the deployment server also matches clients by IP address
+	names := []string{host}
+	for _, rec := range ex.Records {
+		names = append(names, rec.Entry.IPAddress)
+	}
+	for _, t := range r.targets {
+		te, err := r.explainTarget(t, host, names, routed, hostsByDest, patternsByDest)
+		if err != nil {
+			return ex, err
+		}
+		ex.Targets = append(ex.Targets, te)
+	}
+	return ex, nil
+}
+
+func (r *Runner) explainTarget(t Target, host string, names []string, routed map[string]bool, hostsByDest, patternsByDest map[string][]string) (TargetExplanation, error) {
+	te := TargetExplanation{Target: t.Name, File: t.Updater.Path()}
+	if p, err := t.Updater.Paused(); err != nil {
+		return te, err
+	} else if p != nil {
+		te.Paused = true
+	}
+	filters, err := t.Updater.ClassFilters()
+	if err != nil {
+		return te, err
+	}
+
+	byClass := map[string]*ClassExplanation{}
+	get := func(class string) *ClassExplanation {
+		if byClass[class] == nil {
+			byClass[class] = &ClassExplanation{Class: class}
+		}
+		return byClass[class]
+	}
+	// classes the tool manages: expected when their destination has the host
+	for _, app := range sortedKeys(t.AppClass) {
+		dest := t.AppDestination[app]
+		if dest == "" {
+			continue
+		}
+		ce := get(t.AppClass[app])
+		ce.Apps = append(ce.Apps, app)
+		ce.Destination = dest
+		ce.Expected = ce.Expected || routed[dest]
+		// apps are applied in sorted order, so the last one's patterns end up in the class
+		pats, _ := r.classPatterns(dest, ce.Class, hostsByDest, patternsByDest)
+		ce.Patterns = nil
+		for _, p := range pats {
+			if patterns.Match(p, host) {
+				ce.Patterns = append(ce.Patterns, p)
+			}
+		}
+	}
+	// classes whose current filters match the host
+	for _, f := range filters {
+		wl, bl, included := f.Evaluate(names...)
+		if !included && len(wl) == 0 && len(bl) == 0 && byClass[f.Class] == nil {
+			continue
+		}
+		ce := get(f.Class)
+		ce.Whitelisted, ce.Blacklisted, ce.Unresolved = wl, bl, f.Unresolved
+		ce.FilterType = f.FilterType
+	}
+
+	for _, class := range sortedKeys(byClass) {
+		te.Classes = append(te.Classes, *byClass[class])
+	}
+	return te, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,30 @@
+package runner
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// durationBuckets suit durations of a sync cycle or a CMDB fetch, in seconds.
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+var (
+	cycleDuration = promauto.NewHistogram(prometheus.HistogramOpts{Name: "camr_cycle_duration_seconds",
+		Help: "Duration of sync cycles.", Buckets: durationBuckets})
+	cycles = promauto.NewCounterVec(prometheus.CounterOpts{Name: "camr_cycles_total",
+		Help: "Sync cycles by outcome (success or error)."}, []string{"outcome"})
+	lastSuccess = promauto.NewGauge(prometheus.GaugeOpts{Name: "camr_last_success_timestamp_seconds",
+		Help: "Unix time of the last sync cycle that completed without errors."})
+	targetCycles = promauto.NewCounterVec(prometheus.CounterOpts{Name: "camr_target_cycles_total",
+		Help: "Per-target updates by outcome (success, error or paused)."}, []string{"target", "outcome"})
+	cmdbFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{Name: "camr_cmdb_fetch_duration_seconds",
+		Help: "Duration of CMDB fetches.", Buckets: durationBuckets})
+	cmdbFetchErrors = promauto.NewCounter(prometheus.CounterOpts{Name: "camr_cmdb_fetch_errors_total",
+		Help: "Failed CMDB fetches."})
+	cmdbEntries = promauto.NewGauge(prometheus.GaugeOpts{Name: "camr_cmdb_entries",
+		Help: "Entries returned by the last CMDB fetch."})
+	destinationHosts = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "camr_destination_hosts",
+		Help: "Hosts routed to each destination in the last cycle."}, []string{"destination"})
+	destinationPatterns = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "camr_destination_patterns",
+		Help: "Whitelist patterns generated for each destination in the last cycle."}, []string{"destination"})
+)
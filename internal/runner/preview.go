@@ -0,0 +1,254 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/dsclients"
+	"github.com/example/splunk-ds-camr/internal/patterns"
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+// previewSample is the number of matched hosts listed per pattern.
+const previewSample = 5
+
+// Pattern changes in a plan.
+const (
+	ChangeAdd    = "add"
+	ChangeKeep   = "keep"
+	ChangeRemove = "remove"
+)
+
+// PatternPreview shows which known hosts a whitelist pattern matches.
+type PatternPreview struct {
+	Pattern string   `json:"pattern"`
+	Change  string   `json:"change,omitempty"`
+	Matches int      `json:"matches"`
+	Sample  []string `json:"sample"`
+	// Foreign are matched hosts routed only to other destinations.
+	Foreign []ForeignHost `json:"foreign,omitempty"`
+	// Unknown are matched hosts routed nowhere, or phoning home without a CMDB record.
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// Safe reports whether the pattern only matches hosts of its own destination.
+func (p PatternPreview) Safe() bool { return len(p.Foreign) == 0 && len(p.Unknown) == 0 }
+
+// ForeignHost is a host matched by a pattern of a destination it is not routed to.
+type ForeignHost struct {
+	Host         string   `json:"host"`
+	Destinations []string `json:"destinations"`
+}
+
+// Plan is what the next cycle would write, with a preview of every pattern.
+type Plan struct {
+	Entries  int          `json:"entries"`
+	Snapshot string       `json:"cmdbSnapshot"`
+	Clients  int          `json:"unknownClients,omitempty"` // phone-home clients taken into account
+	Targets  []TargetPlan `json:"targets"`
+}
+
+// TargetPlan is the plan of one target.
+type TargetPlan struct {
+	Target  string      `json:"target"`
+	File    string      `json:"file"`
+	Paused  bool        `json:"paused,omitempty"`
+	Classes []ClassPlan `json:"classes"`
+}
+
+// ClassPlan compares the published and the proposed whitelist of one app's class.
+type ClassPlan struct {
+	App         string           `json:"app"`
+	Class       string           `json:"class"`
+	Destination string           `json:"destination"`
+	Hosts       int              `json:"hosts"` // hosts routed to the destination
+	Mode        string           `json:"mode"`  // effective wildcard mode
+	MaxPatterns int              `json:"maxPatterns,omitempty"`
+	Patterns    []PatternPreview `json:"patterns"`
+}
+
+// Counts returns the number of added, kept and removed patterns.
+func (c ClassPlan) Counts() (add, keep, remove int) {
+	for _, p := range c.Patterns {
+		switch p.Change {
+		case ChangeAdd:
+			add++
+		case ChangeKeep:
+			keep++
+		case ChangeRemove:
+			remove++
+		}
+	}
+	return add, keep, remove
+}
+
+// hostIndex knows every host a pattern may match and where it is routed.
+type hostIndex struct {
+	hosts []string            // sorted
+	dests map[string][]string // lowercase host -> destinations, none when unrouted
+}
+
+// newHostIndex indexes the CMDB entries and any extra hosts only known to phone home.
+func newHostIndex(entries []cmdb.Entry, hostsByDest map[string][]string, extra []string) *hostIndex {
+	ix := &hostIndex{dests: map[string][]string{}}
+	add := func(h string) {
+		key := strings.ToLower(h)
+		if _, ok := ix.dests[key]; ok || h == "" {
+			return
+		}
+		ix.dests[key] = nil
+		ix.hosts = append(ix.hosts, h)
+	}
+	for _, e := range entries {
+		add(e.Hostname)
+	}
+	for _, h := range extra {
+		add(h)
+	}
+	for _, dest := range sortedKeys(hostsByDest) {
+		for _, h := range hostsByDest[dest] {
+			key := strings.ToLower(h)
+			ix.dests[key] = append(ix.dests[key], dest)
+		}
+	}
+	sort.Strings(ix.hosts)
+	return ix
+}
+
+// preview matches pattern, proposed for dest, against every known host.
+func (ix *hostIndex) preview(pattern, dest string) PatternPreview {
+	p := PatternPreview{Pattern: pattern, Sample: []string{}}
+	re := patterns.Compile(pattern)
+	for _, h := range ix.hosts {
+		if !re.MatchString(h) {
+			continue
+		}
+		p.Matches++
+		if len(p.Sample) < previewSample {
+			p.Sample = append(p.Sample, h)
+		}
+		dests := ix.dests[strings.ToLower(h)]
+		switch {
+		case len(dests) == 0:
+			p.Unknown = append(p.Unknown, h)
+		case !contains(dests, dest):
+			p.Foreign = append(p.Foreign, ForeignHost{Host: h, Destinations: dests})
+		}
+	}
+	return p
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan fetches the CMDB and computes what the next cycle would write to each target,
+// previewing the hosts every added, kept and removed pattern matches. Phone-home clients
+// missing from the CMDB are counted as unknown hosts. Nothing is written.
+func (r *Runner) Plan(ctx context.Context, clients []dsclients.Client) (Plan, error) {
+	entries, err := r.cmdb.Fetch(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+	hostsByDest := r.hostsByDestination(entries)
+	patternsByDest := r.compress(hostsByDest)
+
+	var extra []string
+	for _, c := range dsclients.Reconcile(entries, clients, 0, time.Now()).Unknown {
+		if names := c.Names(); len(names) > 0 {
+			extra = append(extra, names[0])
+		}
+	}
+	ix := newHostIndex(entries, hostsByDest, extra)
+
+	plan := Plan{Entries: len(entries), Snapshot: cmdb.SnapshotID(entries), Clients: len(extra)}
+	for _, t := range r.targets {
+		tp, err := r.planTarget(t, ix, hostsByDest, patternsByDest)
+		if err != nil {
+			return plan, err
+		}
+		plan.Targets = append(plan.Targets, tp)
+	}
+	return plan, nil
+}
+
+func (r *Runner) planTarget(t Target, ix *hostIndex, hostsByDest, patternsByDest map[string][]string) (TargetPlan, error) {
+	tp := TargetPlan{Target: t.Name, File: t.Updater.Path()}
+	if p, err := t.Updater.Paused(); err != nil {
+		return tp, err
+	} else if p != nil {
+		tp.Paused = true
+	}
+	for _, app := range sortedKeys(t.AppClass) {
+		class, dest := t.AppClass[app], t.AppDestination[app]
+		if dest == "" {
+			continue
+		}
+		current, err := t.Updater.Whitelist(class)
+		if err != nil {
+			return tp, err
+		}
+		pats, opts := r.classPatterns(dest, class, hostsByDest, patternsByDest)
+		cp := ClassPlan{App: app, Class: class, Destination: dest, Hosts: len(hostsByDest[dest]),
+			Mode: opts.Mode, MaxPatterns: opts.MaxPatterns}
+		proposed := map[string]bool{}
+		for _, p := range pats {
+			proposed[p] = true
+		}
+		published := map[string]bool{}
+		for _, p := range current {
+			published[p] = true
+		}
+		for _, p := range sortedKeys(proposed) {
+			pv := ix.preview(p, dest)
+			pv.Change = ChangeKeep
+			if !published[p] {
+				pv.Change = ChangeAdd
+			}
+			cp.Patterns = append(cp.Patterns, pv)
+		}
+		for _, p := range sortedKeys(published) {
+			if !proposed[p] {
+				pv := ix.preview(p, dest)
+				pv.Change = ChangeRemove
+				cp.Patterns = append(cp.Patterns, pv)
+			}
+		}
+		tp.Classes = append(tp.Classes, cp)
+	}
+	return tp, nil
+}
+
+// logDryRunPreview logs the hosts matched by each pattern a dry-run change would add,
+// warning about patterns reaching hosts of other destinations or unknown hosts.
+func logDryRunPreview(t Target, changes []serverclass.Change, ix func() *hostIndex) {
+	for _, c := range changes {
+		if !c.DryRun || len(c.Added) == 0 {
+			continue
+		}
+		dest := t.AppDestination[c.App]
+		for _, p := range c.Added {
+			pv := ix().preview(p, dest)
+			attrs := []any{"target", t.Name, "class", c.Class, "destination", dest, "pattern", p,
+				"matches", pv.Matches, "sample", pv.Sample}
+			if pv.Safe() {
+				slog.Info("dry-run pattern preview", attrs...)
+				continue
+			}
+			foreign := make([]string, 0, len(pv.Foreign))
+			for _, f := range pv.Foreign {
+				foreign = append(foreign, f.Host+" ("+strings.Join(f.Destinations, ",")+")")
+			}
+			slog.Warn("dry-run pattern matches hosts outside its destination", append(attrs, "foreign", foreign, "unknown", pv.Unknown)...)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/example/splunk-ds-camr/internal/dsclients"
+)
+
+// Reconcile fetches the CMDB and the clients phoning home to the deployment server and
+// reports the differences; see dsclients.Reconcile.
+func (r *Runner) Reconcile(ctx context.Context, src dsclients.Source, staleAfter time.Duration) (dsclients.Report, error) {
+	entries, err := r.cmdb.Fetch(ctx)
+	if err != nil {
+		return dsclients.Report{}, fmt.Errorf("cmdb: %w", err)
+	}
+	clients, err := src.Clients(ctx)
+	if err != nil {
+		return dsclients.Report{}, fmt.Errorf("deployment server: %w", err)
+	}
+	return dsclients.Reconcile(entries, clients, staleAfter, time.Now()), nil
+}
@@ -0,0 +1,389 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/splunk-ds-camr/internal/audit"
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/patterns"
+	"github.com/example/splunk-ds-camr/internal/routing"
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+// Target pairs a serverclass.conf updater with the apps it owns.
+type Target struct {
+	Name           string
+	Updater        *serverclass.Updater
+	AppClass       map[string]string // app -> class name
+	AppDestination map[string]string // app -> dest key
+	Classes        map[string]serverclass.ClassSpec
+}
+
+// Runner performs sync cycles: one CMDB fetch, routed and compressed once, applied to every target.
+type Runner struct {
+	cmdb     cmdb.Client
+	router   *routing.Engine
+	wildcard config.WildcardConfig
+	targets  []Target
+
+	// cycleMu serializes cycles; trigger holds at most one pending on-demand cycle
+	cycleMu sync.Mutex
+	trigger chan string
+
+	mu           sync.Mutex
+	running      *Run
+	last         *Run
+	lastSuccess  time.Time
+	history      []Run
+	historySize  int
+	lastPatterns map[string]map[string][]string // whitelist patterns per target and class of the last cycle
+	// snapshot is the CMDB as of the last fetch; pendingIDs are records reported changed
+	// since, and fullRequested asks the next triggered cycle for a full fetch
+	snapshot      []cmdb.Entry
+	pendingIDs    map[string]bool
+	fullRequested bool
+	lastHosts     map[string][]string // hosts per destination of the last cycle, for the audit log
+	// proposed holds, per target, the dry-run proposals already previewed and audited
+	proposed map[string]map[string]string
+
+	audit      *audit.Log
+	configHash string
+}
+
+// New builds a Runner with one updater per configured serverclass target.
+func New(cfg *config.Config, c cmdb.Client) (*Runner, error) {
+	router, err := routing.New(cfg.Routing, cfg.Destinations)
+	if err != nil {
+		return nil, err
+	}
+	r := &Runner{cmdb: c, router: router, wildcard: cfg.Wildcard, historySize: cfg.HTTP.History, trigger: make(chan string, 1)}
+	if r.historySize <= 0 {
+		r.historySize = DefaultHistory
+	}
+	if cfg.Audit.File != "" {
+		r.audit = audit.New(cfg.Audit.File)
+		r.configHash = cfg.Hash()
+	}
+	for _, t := range cfg.Serverclass.EffectiveTargets() {
+		r.targets = append(r.targets, Target{
+			Name: t.Name,
+			Updater: serverclass.NewUpdater(serverclass.Config{
+				Path:             t.Path,
+				Backup:           t.Backup,
+				AppClass:         t.AppClass,
+				AppDestination:   t.AppDestination,
+				DryRun:           cfg.DryRun || t.DryRun,
+				DryRunApps:       t.DryRunApps,
+				ManagedIndexBase: t.ManagedIndexBase,
+				WhitelistMode:    t.WhitelistMode,
+				PathnameClasses:  t.PathnameClasses,
+				HostListDir:      t.HostListDir,
+				HostListRef:      t.HostListRef,
+				BackupDir:        t.BackupDir,
+				Retention: serverclass.Retention{
+					KeepLast:      t.BackupRetention.KeepLast,
+					MaxAge:        time.Duration(t.BackupRetention.MaxAgeDays) * 24 * time.Hour,
+					CompressAfter: t.BackupRetention.CompressAfter,
+				},
+				ReloadCommand: t.ReloadCommand,
+				Lock: serverclass.LockOptions{
+					Wait:       cfg.Serverclass.Lock.Wait.Duration,
+					StaleAfter: cfg.Serverclass.Lock.StaleAfter.Duration,
+				},
+			}),
+			AppClass:       t.AppClass,
+			AppDestination: t.AppDestination,
+			Classes:        classSpecs(t.Classes),
+		})
+	}
+	return r, nil
+}
+
+// Targets exposes the configured targets (e.g. to swap the filesystem in tests).
+func (r *Runner) Targets() []Target { return r.targets }
+
+// Target returns the named target; an empty name selects the only target.
+func (r *Runner) Target(name string) (Target, error) {
+	names := make([]string, 0, len(r.targets))
+	for _, t := range r.targets {
+		if t.Name == name || (name == "" && len(r.targets) == 1) {
+			return t, nil
+		}
+		names = append(names, t.Name)
+	}
+	if name == "" {
+		return Target{}, fmt.Errorf("several targets configured, choose one of %v", names)
+	}
+	return Target{}, fmt.Errorf("unknown target %q, choose one of %v", name, names)
+}
+
+// RunOnce fetches the CMDB and updates every target. A failing target does not stop the
+// others; all target errors are returned joined. Concurrent calls run one after the other.
+func (r *Runner) RunOnce(ctx context.Context) error {
+	return r.cycle(ctx, r.fetchAll)
+}
+
+// fetchAll fetches the whole CMDB and keeps it as the snapshot for targeted resyncs.
+func (r *Runner) fetchAll(ctx context.Context, run *Run) ([]cmdb.Entry, error) {
+	fetchStart := time.Now()
+	entries, err := r.cmdb.Fetch(ctx)
+	cmdbFetchDuration.Observe(time.Since(fetchStart).Seconds())
+	if err != nil {
+		cmdbFetchErrors.Inc()
+		run.CMDBError = err.Error()
+		return nil, err
+	}
+	r.mu.Lock()
+	r.snapshot = entries
+	r.mu.Unlock()
+	return entries, nil
+}
+
+// cycle runs one sync cycle on the entries returned by fetch.
+func (r *Runner) cycle(ctx context.Context, fetch func(context.Context, *Run) ([]cmdb.Entry, error)) (err error) {
+	r.cycleMu.Lock()
+	defer r.cycleMu.Unlock()
+	run := r.begin()
+	defer func() {
+		if err != nil && len(run.Errors) == 0 {
+			run.Errors = append(run.Errors, err.Error())
+		}
+		r.finish(run)
+		cycleDuration.Observe(run.End.Sub(run.Start).Seconds())
+		if err != nil {
+			cycles.WithLabelValues("error").Inc()
+			return
+		}
+		cycles.WithLabelValues("success").Inc()
+		lastSuccess.SetToCurrentTime()
+	}()
+
+	entries, err := fetch(ctx, run)
+	if err != nil {
+		return err
+	}
+	run.Snapshot = cmdb.SnapshotID(entries)
+	run.Entries = len(entries)
+	cmdbEntries.Set(float64(len(entries)))
+	hostsByDest := r.hostsByDestination(entries)
+	patternsByDest := r.compress(hostsByDest)
+	destinationHosts.Reset()
+	destinationPatterns.Reset()
+	run.Destinations = make(map[string]DestinationStats, len(hostsByDest))
+	for dest, hosts := range hostsByDest {
+		destinationHosts.WithLabelValues(dest).Set(float64(len(hosts)))
+		destinationPatterns.WithLabelValues(dest).Set(float64(len(patternsByDest[dest])))
+		run.Destinations[dest] = DestinationStats{Hosts: len(hosts), Patterns: len(patternsByDest[dest])}
+	}
+	r.mu.Lock()
+	prevHosts := r.lastHosts
+	r.lastHosts = hostsByDest
+	r.mu.Unlock()
+
+	// built on the first dry-run change only
+	var ix *hostIndex
+	index := func() *hostIndex {
+		if ix == nil {
+			ix = newHostIndex(entries, hostsByDest, nil)
+		}
+		return ix
+	}
+	var errs []error
+	for _, t := range r.targets {
+		drifts, err := r.applyTarget(ctx, t, hostsByDest, patternsByDest)
+		changes := t.Updater.TakeChanges()
+		run.Changes = append(run.Changes, changes...)
+		// a dry-run proposal is previewed and audited once, not again every cycle
+		changes, drifts = r.newProposals(t, changes, drifts, err == nil)
+		logDryRunPreview(t, changes, index)
+		r.writeAudit(t, run, changes, drifts, hostsByDest, prevHosts)
+		if err != nil {
+			targetCycles.WithLabelValues(t.Name, "error").Inc()
+			err = fmt.Errorf("target %s: %w", t.Name, err)
+			run.Errors = append(run.Errors, err.Error())
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hostsByDestination routes entries to destinations.
+func (r *Runner) hostsByDestination(entries []cmdb.Entry) map[string][]string {
+	// A host may land in several destinations; duplicate CMDB rows are collapsed
+	// so a single host never counts as a group of two when compressing.
+	hostsByDest := map[string][]string{}
+	seen := map[string]map[string]bool{}
+	for _, e := range entries {
+		res := r.router.Route(e)
+		slog.Debug("routed host", "host", e.Hostname, "destinations", res.Destinations, "trace", res.Trace)
+		if len(res.Destinations) == 0 {
+			cmdb.SkippedEntries.WithLabelValues("no_destination").Inc()
+		}
+		for _, dest := range res.Destinations {
+			if seen[dest] == nil {
+				seen[dest] = map[string]bool{}
+			}
+			if seen[dest][e.Hostname] {
+				continue
+			}
+			seen[dest][e.Hostname] = true
+			hostsByDest[dest] = append(hostsByDest[dest], e.Hostname)
+		}
+	}
+	return hostsByDest
+}
+
+// compress turns each destination's hosts into wildcard patterns, with the destination's
+// wildcard options.
+func (r *Runner) compress(hostsByDest map[string][]string) map[string][]string {
+	patternsByDest := map[string][]string{}
+	for dest, hosts := range hostsByDest {
+		patternsByDest[dest] = generate(hosts, r.wildcard.For(dest, ""))
+	}
+	return patternsByDest
+}
+
+// classPatterns returns the whitelist of a class fed by dest: the destination's patterns,
+// or the destination's hosts compressed anew when the class has its own wildcard options.
+// Over maxPatterns, those patterns are compressed further to fit (see patterns.FitBudget),
+// never matching another destination's hosts; exact mode is never generalized. If no safe
+// generalization fits, the most compressed safe set is returned, still over budget.
+func (r *Runner) classPatterns(dest, class string, hostsByDest, patternsByDest map[string][]string) ([]string, config.WildcardConfig) {
+	opts := r.wildcard.For(dest, class)
+	pats := patternsByDest[dest]
+	if _, own := r.wildcard.Classes[class]; own {
+		pats = generate(hostsByDest[dest], opts)
+	}
+	if opts.MaxPatterns <= 0 || len(pats) <= opts.MaxPatterns || opts.Mode == "exact" {
+		return pats, opts
+	}
+	fitted, _ := patterns.FitBudget(pats, hostsByDest[dest], otherHosts(dest, hostsByDest), opts.MaxPatterns, patternOptions(opts))
+	slog.Debug("compressed whitelist to fit maxPatterns", "class", class, "destination", dest,
+		"mode", opts.Mode, "modePatterns", len(pats), "patterns", len(fitted), "maxPatterns", opts.MaxPatterns)
+	return fitted, opts
+}
+
+// otherHosts returns the hosts routed to any destination but dest.
+func otherHosts(dest string, hostsByDest map[string][]string) []string {
+	own := map[string]bool{}
+	for _, h := range hostsByDest[dest] {
+		own[strings.ToLower(h)] = true
+	}
+	var out []string
+	for d, hosts := range hostsByDest {
+		if d == dest {
+			continue
+		}
+		for _, h := range hosts {
+			if !own[strings.ToLower(h)] {
+				out = append(out, h)
+			}
+		}
+	}
+	return out
+}
+
+func generate(hosts []string, w config.WildcardConfig) []string {
+	return patterns.GenerateWildcardsWithOptions(hosts, patternOptions(w))
+}
+
+func patternOptions(w config.WildcardConfig) patterns.Options {
+	return patterns.Options{
+		Mode:                  w.Mode,
+		MinGroupSize:          w.MinGroupSize,
+		RequireMinFixedPrefix: w.RequireMinFixedPrefix,
+		Separators:            w.Separators,
+		WholeTokens:           w.WholeTokens,
+		MaxVaryingTokens:      w.MaxVaryingTokens,
+	}
+}
+
+func classSpecs(classes map[string]config.ManagedClass) map[string]serverclass.ClassSpec {
+	if len(classes) == 0 {
+		return nil
+	}
+	out := make(map[string]serverclass.ClassSpec, len(classes))
+	for name, c := range classes {
+		spec := serverclass.ClassSpec{Settings: c.Keys(), Apps: map[string]map[string]string{}}
+		for app, a := range c.Apps {
+			spec.Apps[app] = a.Keys()
+		}
+		out[name] = spec
+	}
+	return out
+}
+
+// applyTarget updates one target and returns the stanza drift found.
+func (r *Runner) applyTarget(ctx context.Context, t Target, hostsByDest, patternsByDest map[string][]string) ([]serverclass.Drift, error) {
+	// one writer per file for the whole read-modify-write cycle
+	unlock, err := t.Updater.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// a restored (rolled back) file stays untouched until explicitly resumed
+	if p, err := t.Updater.Paused(); err != nil {
+		return nil, err
+	} else if p != nil {
+		slog.Warn("target paused, skipping update", "target", t.Name, "since", p.Since, "reason", p.Reason, "restoredFrom", p.RestoredFrom)
+		targetCycles.WithLabelValues(t.Name, "paused").Inc()
+		return nil, nil
+	}
+	computed := map[string][]string{}
+	defer r.recordPatterns(t.Name, computed)
+	// owned stanzas first so whitelists land in a fully configured class
+	var drifts []serverclass.Drift
+	if len(t.Classes) > 0 {
+		if drifts, err = t.Updater.EnsureStanzas(t.Classes); err != nil {
+			// nothing was written
+			return nil, err
+		}
+	}
+	// iterate apps in sorted order so logs and write order are deterministic
+	apps := make([]string, 0, len(t.AppClass))
+	for app := range t.AppClass {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	for _, app := range apps {
+		class := t.AppClass[app]
+		dest := t.AppDestination[app]
+		if dest == "" {
+			continue
+		}
+		pats, opts := r.classPatterns(dest, class, hostsByDest, patternsByDest)
+		computed[class] = pats
+		if opts.MaxPatterns > 0 && len(pats) > opts.MaxPatterns {
+			reason := "no generalization within the mode's constraints fits without matching other destinations' hosts"
+			if opts.Mode == "exact" {
+				reason = "exact mode is never generalized"
+			}
+			slog.Warn("whitelist exceeds maxPatterns", "target", t.Name, "class", class, "destination", dest,
+				"patterns", len(pats), "maxPatterns", opts.MaxPatterns, "mode", opts.Mode, "reason", reason)
+		}
+		if err := t.Updater.UpdateWhitelist(app, class, pats); err != nil {
+			return drifts, err
+		}
+	}
+	targetCycles.WithLabelValues(t.Name, "success").Inc()
+	return drifts, nil
+}
+
+// recordPatterns keeps the whitelist patterns computed for a target's classes, for ClassWhitelist.
+func (r *Runner) recordPatterns(target string, byClass map[string][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastPatterns == nil {
+		r.lastPatterns = map[string]map[string][]string{}
+	}
+	r.lastPatterns[target] = byClass
+}
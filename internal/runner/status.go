@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+// DefaultHistory is how many runs History keeps by default.
+const DefaultHistory = 20
+
+// Run summarizes one sync cycle.
+type Run struct {
+	Start        time.Time                   `json:"start"`
+	End          time.Time                   `json:"end"`
+	Entries      int                         `json:"entries"`
+	Snapshot     string                      `json:"cmdbSnapshot,omitempty"` // cmdb.SnapshotID of the entries
+	Targeted     []string                    `json:"targeted,omitempty"`     // record IDs re-fetched by a targeted resync
+	Destinations map[string]DestinationStats `json:"destinations,omitempty"`
+	Changes      []serverclass.Change        `json:"changes,omitempty"` // applied and dry-run whitelist changes
+	CMDBError    string                      `json:"cmdbError,omitempty"`
+	Errors       []string                    `json:"errors,omitempty"` // CMDB and per-target errors
+}
+
+// DestinationStats counts what a cycle routed to one destination.
+type DestinationStats struct {
+	Hosts    int `json:"hosts"`
+	Patterns int `json:"patterns"`
+}
+
+// OK reports whether the cycle completed without errors.
+func (r Run) OK() bool { return len(r.Errors) == 0 }
+
+// Status is a snapshot of the runner's progress, safe to read while cycles run.
+type Status struct {
+	Running     *Run      `json:"running,omitempty"` // cycle in progress, if any
+	Last        *Run      `json:"last,omitempty"`    // last completed cycle
+	LastSuccess time.Time `json:"lastSuccess"`       // end of the last cycle without errors
+}
+
+// Status returns the current status.
+func (r *Runner) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var st Status
+	if r.running != nil {
+		cur := *r.running
+		st.Running = &cur
+	}
+	if r.last != nil {
+		last := *r.last
+		st.Last = &last
+	}
+	st.LastSuccess = r.lastSuccess
+	return st
+}
+
+// begin records the start of a cycle.
+func (r *Runner) begin() *Run {
+	run := &Run{Start: time.Now().UTC()}
+	r.mu.Lock()
+	r.running = &Run{Start: run.Start}
+	r.mu.Unlock()
+	return run
+}
+
+// finish records a completed cycle.
+func (r *Runner) finish(run *Run) {
+	run.End = time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running = nil
+	r.last = run
+	if run.OK() {
+		r.lastSuccess = run.End
+	}
+	r.history = append(r.history, *run)
+	if over := len(r.history) - r.historySize; over > 0 {
+		r.history = append([]Run(nil), r.history[over:]...)
+	}
+}
+
+// History returns up to n completed runs, newest first (n <= 0 returns all kept runs).
+func (r *Runner) History(n int) []Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n <= 0 || n > len(r.history) {
+		n = len(r.history)
+	}
+	out := make([]Run, 0, n)
+	for i := len(r.history) - 1; i >= len(r.history)-n; i-- {
+		out = append(out, r.history[i])
+	}
+	return out
+}
+
+// ClassWhitelist is a class's whitelist as computed in the last cycle and as currently
+// published in the target.
+type ClassWhitelist struct {
+	Target      string   `json:"target"`
+	Class       string   `json:"class"`
+	Apps        []string `json:"apps"`
+	Destination string   `json:"destination"`
+	Computed    []string `json:"computed"` // nil until a cycle computed the class
+	Current     []string `json:"current"`  // managed entries in serverclass.conf or the host list
+}
+
+// ClassWhitelist looks up a class in the named target (empty selects the only target).
+func (r *Runner) ClassWhitelist(target, class string) (ClassWhitelist, error) {
+	t, err := r.Target(target)
+	if err != nil {
+		return ClassWhitelist{}, err
+	}
+	cw := ClassWhitelist{Target: t.Name, Class: class}
+	for app, c := range t.AppClass {
+		if c == class {
+			cw.Apps = append(cw.Apps, app)
+		}
+	}
+	if len(cw.Apps) == 0 {
+		return ClassWhitelist{}, fmt.Errorf("class %q is not managed in target %s", class, t.Name)
+	}
+	sort.Strings(cw.Apps)
+	// apps are applied in sorted order, so the last one with a destination wins
+	for _, app := range cw.Apps {
+		if d := t.AppDestination[app]; d != "" {
+			cw.Destination = d
+		}
+	}
+	r.mu.Lock()
+	if pats, ok := r.lastPatterns[t.Name][class]; ok {
+		cw.Computed = append([]string{}, pats...)
+	}
+	r.mu.Unlock()
+	if cw.Current, err = t.Updater.Whitelist(class); err != nil {
+		return ClassWhitelist{}, err
+	}
+	return cw, nil
+}
+
+// CheckWritable reports, per target name, whether its serverclass.conf can be written.
+func (r *Runner) CheckWritable() map[string]error {
+	out := make(map[string]error, len(r.targets))
+	for _, t := range r.targets {
+		out[t.Name] = t.Updater.CheckWritable()
+	}
+	return out
+}
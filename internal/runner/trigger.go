@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+)
+
+// maxTargetedRecords caps a targeted resync; more changed records are cheaper to get with
+// one full fetch.
+const maxTargetedRecords = 50
+
+// Trigger asks the sync loop for an immediate full cycle. Triggers arriving while one is
+// already pending are coalesced into it; it reports whether a new cycle was queued.
+func (r *Runner) Trigger(reason string) bool {
+	r.mu.Lock()
+	r.fullRequested = true
+	r.mu.Unlock()
+	return r.queue(reason)
+}
+
+// NotifyChanged reports CMDB records (by ID) that changed, and queues a targeted resync
+// that re-fetches only those records.
+func (r *Runner) NotifyChanged(reason string, ids ...string) bool {
+	r.mu.Lock()
+	if r.pendingIDs == nil {
+		r.pendingIDs = map[string]bool{}
+	}
+	for _, id := range ids {
+		r.pendingIDs[id] = true
+	}
+	r.mu.Unlock()
+	return r.queue(reason)
+}
+
+func (r *Runner) queue(reason string) bool {
+	select {
+	case r.trigger <- reason:
+		slog.Info("sync triggered", "reason", reason)
+		return true
+	default:
+		slog.Debug("sync already pending, trigger coalesced", "reason", reason)
+		return false
+	}
+}
+
+// Triggers delivers the reason of each queued on-demand cycle to the sync loop, which
+// should then call RunTriggered.
+func (r *Runner) Triggers() <-chan string { return r.trigger }
+
+// RunTriggered runs the cycle requested through Trigger or NotifyChanged. When only
+// changed records are pending, the CMDB client supports fetching single records and a
+// snapshot from an earlier full fetch exists, only those records are re-fetched and patched
+// into the snapshot; otherwise it is a full cycle.
+func (r *Runner) RunTriggered(ctx context.Context) error {
+	r.mu.Lock()
+	ids := make([]string, 0, len(r.pendingIDs))
+	for id := range r.pendingIDs {
+		ids = append(ids, id)
+	}
+	full := r.fullRequested || r.snapshot == nil || len(ids) == 0 || len(ids) > maxTargetedRecords
+	r.pendingIDs = nil
+	r.fullRequested = false
+	r.mu.Unlock()
+
+	fetcher, ok := r.cmdb.(cmdb.RecordFetcher)
+	if full || !ok {
+		return r.RunOnce(ctx)
+	}
+	sort.Strings(ids)
+	return r.cycle(ctx, func(ctx context.Context, run *Run) ([]cmdb.Entry, error) {
+		run.Targeted = ids
+		r.mu.Lock()
+		entries := append([]cmdb.Entry(nil), r.snapshot...)
+		r.mu.Unlock()
+		for _, id := range ids {
+			got, err := fetcher.FetchByID(ctx, id)
+			if err != nil {
+				cmdbFetchErrors.Inc()
+				run.CMDBError = err.Error()
+				return nil, err
+			}
+			kept := entries[:0]
+			for _, e := range entries {
+				if e.ID != id {
+					kept = append(kept, e)
+				}
+			}
+			entries = append(kept, got...)
+		}
+		r.mu.Lock()
+		r.snapshot = entries
+		r.mu.Unlock()
+		return entries, nil
+	})
+}
@@ -0,0 +1,246 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+)
+
+// Violation kinds reported by Verify.
+const (
+	// ViolationWrongClass: the host gets a managed class whose destination it is not routed to.
+	ViolationWrongClass = "wrong_class"
+	// ViolationMissing: the host is routed to a destination but does not get its class.
+	ViolationMissing = "missing"
+	// ViolationNoClass: the host gets no class of any checked target. Hosts routed only
+	// to destinations of targets not checked are skipped.
+	ViolationNoClass = "no_class"
+	// ViolationMultipleDestinations: the host gets the classes of several destinations
+	// although it is not routed to all of them.
+	ViolationMultipleDestinations = "multiple_destinations"
+	// ViolationUnusedPattern: a whitelist entry matches no CMDB host.
+	ViolationUnusedPattern = "unused_pattern"
+)
+
+// Violation is one finding of Verify.
+type Violation struct {
+	Kind         string   `json:"kind"`
+	Target       string   `json:"target,omitempty"`
+	Host         string   `json:"host,omitempty"`
+	Class        string   `json:"class,omitempty"`
+	Destinations []string `json:"destinations,omitempty"`
+	Key          string   `json:"key,omitempty"`
+	Pattern      string   `json:"pattern,omitempty"`
+	Detail       string   `json:"detail"`
+}
+
+// Verification is the result of checking every target's current serverclass.conf
+// against the CMDB.
+type Verification struct {
+	Hosts      int                  `json:"hosts"`
+	Snapshot   string               `json:"cmdbSnapshot"`
+	Targets    []TargetVerification `json:"targets"`
+	Violations []Violation          `json:"violations"`
+}
+
+// TargetVerification summarizes one checked target.
+type TargetVerification struct {
+	Target  string `json:"target"`
+	File    string `json:"file"`
+	Classes int    `json:"classes"`
+	// Unresolved lists host list files that could not be read; hosts they would match are
+	// not taken into account.
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// OK reports whether no violation was found.
+func (v Verification) OK() bool { return len(v.Violations) == 0 }
+
+// verifyHost is a CMDB host with every name the deployment server may match it by and
+// the destinations its records are routed to.
+type verifyHost struct {
+	name   string
+	names  []string
+	routed map[string]bool
+}
+
+// Verify fetches the CMDB and evaluates the whitelists and blacklists currently published
+// in each target's serverclass.conf (or only the named one) against every host, with the
+// deployment server's matching semantics. Nothing is written.
+func (r *Runner) Verify(ctx context.Context, target string) (Verification, error) {
+	targets := r.targets
+	if target != "" {
+		t, err := r.Target(target)
+		if err != nil {
+			return Verification{}, err
+		}
+		targets = []Target{t}
+	}
+	entries, err := r.cmdb.Fetch(ctx)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	byName := map[string]*verifyHost{}
+	var hosts []*verifyHost
+	for _, e := range entries {
+		key := strings.ToLower(e.Hostname)
+		h := byName[key]
+		if h == nil {
+			h = &verifyHost{name: e.Hostname, names: []string{e.Hostname}, routed: map[string]bool{}}
+			byName[key] = h
+			hosts = append(hosts, h)
+		}
+		if e.IPAddress != "" {
+			h.names = append(h.names, e.IPAddress)
+		}
+		for _, d := range r.router.Route(e).Destinations {
+			h.routed[d] = true
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].name < hosts[j].name })
+
+	v := Verification{Hosts: len(hosts), Snapshot: cmdb.SnapshotID(entries), Violations: []Violation{}}
+	matched := map[*verifyHost]bool{}
+	for _, t := range targets {
+		tv, violations, err := verifyTarget(t, hosts, matched)
+		if err != nil {
+			return v, fmt.Errorf("target %s: %w", t.Name, err)
+		}
+		v.Targets = append(v.Targets, tv)
+		v.Violations = append(v.Violations, violations...)
+	}
+	v.Violations = append(v.Violations, unmatchedHosts(targets, hosts, matched)...)
+	return v, nil
+}
+
+// unmatchedHosts reports the hosts no class of any of targets matches. A host is
+// attributed to the first target managing one of its destinations; hosts routed only to
+// destinations none of targets manages belong to other deployment servers and are
+// skipped, unrouted hosts are reported without a target.
+func unmatchedHosts(targets []Target, hosts []*verifyHost, matched map[*verifyHost]bool) []Violation {
+	var out []Violation
+	for _, h := range hosts {
+		if matched[h] {
+			continue
+		}
+		routed := sortedKeys(h.routed)
+		if len(routed) == 0 {
+			out = append(out, Violation{Kind: ViolationNoClass, Host: h.name, Detail: "not routed to any destination"})
+			continue
+		}
+	targets:
+		for _, t := range targets {
+			for _, d := range t.AppDestination {
+				if h.routed[d] {
+					out = append(out, Violation{Kind: ViolationNoClass, Target: t.Name, Host: h.name, Destinations: routed,
+						Detail: "routed to " + strings.Join(routed, ", ") + " but matches no class"})
+					break targets
+				}
+			}
+		}
+	}
+	return out
+}
+
+// verifyTarget checks t's classes against hosts and marks the hosts any of them includes
+// in matched.
+func verifyTarget(t Target, hosts []*verifyHost, matched map[*verifyHost]bool) (TargetVerification, []Violation, error) {
+	tv := TargetVerification{Target: t.Name, File: t.Updater.Path()}
+	filters, err := t.Updater.ClassFilters()
+	if err != nil {
+		return tv, nil, err
+	}
+	tv.Classes = len(filters)
+	for _, f := range filters {
+		tv.Unresolved = append(tv.Unresolved, f.Unresolved...)
+	}
+
+	// destinations of the classes the tool manages
+	classDests := map[string]map[string]bool{}
+	for app, class := range t.AppClass {
+		if dest := t.AppDestination[app]; dest != "" {
+			if classDests[class] == nil {
+				classDests[class] = map[string]bool{}
+			}
+			classDests[class][dest] = true
+		}
+	}
+
+	var out []Violation
+	add := func(v Violation) {
+		v.Target = t.Name
+		out = append(out, v)
+	}
+	for _, h := range hosts {
+		included := map[string]bool{}
+		for _, f := range filters {
+			if _, _, ok := f.Evaluate(h.names...); ok {
+				included[f.Class] = true
+			}
+		}
+		if len(included) == 0 {
+			continue // reported by unmatchedHosts when no target includes it
+		}
+		matched[h] = true
+		routed := sortedKeys(h.routed)
+
+		gotDests := map[string]bool{}
+		for _, class := range sortedKeys(included) {
+			dests := classDests[class]
+			if dests == nil {
+				continue // not managed by the tool
+			}
+			ok := false
+			for d := range dests {
+				gotDests[d] = true
+				ok = ok || h.routed[d]
+			}
+			if !ok {
+				add(Violation{Kind: ViolationWrongClass, Host: h.name, Class: class, Destinations: sortedKeys(dests),
+					Detail: fmt.Sprintf("gets class %s of %s, routed to [%s]", class, strings.Join(sortedKeys(dests), ", "), strings.Join(routed, ", "))})
+			}
+		}
+		for _, class := range sortedKeys(classDests) {
+			if included[class] {
+				continue
+			}
+			for _, d := range sortedKeys(classDests[class]) {
+				if h.routed[d] {
+					add(Violation{Kind: ViolationMissing, Host: h.name, Class: class, Destinations: []string{d},
+						Detail: fmt.Sprintf("routed to %s but does not get class %s", d, class)})
+					break
+				}
+			}
+		}
+		if len(gotDests) > 1 {
+			for d := range gotDests {
+				if !h.routed[d] {
+					add(Violation{Kind: ViolationMultipleDestinations, Host: h.name, Destinations: sortedKeys(gotDests),
+						Detail: "gets the classes of " + strings.Join(sortedKeys(gotDests), ", ")})
+					break
+				}
+			}
+		}
+	}
+
+	for _, f := range filters {
+		for _, e := range f.Whitelist {
+			used := false
+			for _, h := range hosts {
+				if e.Match(h.names...) {
+					used = true
+					break
+				}
+			}
+			if !used {
+				add(Violation{Kind: ViolationUnusedPattern, Class: f.Class, Key: e.Key, Pattern: e.Pattern,
+					Detail: fmt.Sprintf("%s = %s matches no CMDB host", e.Key, e.Pattern)})
+			}
+		}
+	}
+	return tv, out, nil
+}
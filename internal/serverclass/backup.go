@@ -0,0 +1,200 @@
+package serverclass
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405"
+
+// Retention controls how many timestamped backups are kept per file.
+type Retention struct {
+	KeepLast      int           // keep at most this many backups (0 = unlimited)
+	MaxAge        time.Duration // delete backups older than this (0 = forever)
+	CompressAfter int           // gzip backups older than the newest N (0 = never)
+}
+
+// Backup is one timestamped copy of a managed file.
+type Backup struct {
+	Path       string    `json:"path"`
+	Time       time.Time `json:"time"`
+	Seq        int       `json:"seq"` // disambiguates backups taken within the same second
+	Compressed bool      `json:"compressed"`
+}
+
+// backupBase returns the path prefix of path's backups: <backupDir or dir>/<name>.
+func (u *Updater) backupBase(path string) string {
+	if u.backupDir != "" {
+		return filepath.Join(u.backupDir, filepath.Base(path))
+	}
+	return path
+}
+
+// makeTimestampBackup creates a copy of path named <base>.<ts>[.<seq>].bak and then applies
+// the retention policy. The copy is created exclusively, so two backups within the same
+// second get distinct names instead of overwriting each other.
+func (u *Updater) makeTimestampBackup(path string) (string, error) {
+	base := u.backupBase(path)
+	if err := u.fs.MkdirAll(filepath.Dir(base), 0o755); err != nil {
+		return "", err
+	}
+	src, err := u.fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	mode := os.FileMode(0o644)
+	if fi, err := src.Stat(); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	ts := time.Now().UTC().Format(backupTimeFormat)
+	var backupPath string
+	for seq := 0; ; seq++ {
+		backupPath = fmt.Sprintf("%s.%s.bak", base, ts)
+		if seq > 0 {
+			backupPath = fmt.Sprintf("%s.%s.%d.bak", base, ts, seq)
+		}
+		err := u.writeSynced(backupPath, mode, func(w io.Writer) error {
+			_, err := io.Copy(w, src)
+			return err
+		})
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+	u.syncDir(filepath.Dir(backupPath))
+	backupOps.WithLabelValues(path, "created").Inc()
+	if err := u.pruneBackups(path); err != nil {
+		// retention problems must not fail the update itself
+		slog.Warn("backup pruning failed", "file", path, "err", err)
+	}
+	return backupPath, nil
+}
+
+// ListBackups returns the backups of path, newest first.
+func (u *Updater) ListBackups(path string) ([]Backup, error) {
+	base := u.backupBase(path)
+	entries, err := u.readDirNames(filepath.Dir(base))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(base) + "."
+	var out []Backup
+	for _, name := range entries {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		b := Backup{Path: filepath.Join(filepath.Dir(base), name)}
+		if r, ok := strings.CutSuffix(rest, ".bak.gz"); ok {
+			rest, b.Compressed = r, true
+		} else if r, ok := strings.CutSuffix(rest, ".bak"); ok {
+			rest = r
+		} else {
+			continue
+		}
+		tsPart, seqPart, _ := strings.Cut(rest, ".")
+		t, err := time.Parse(backupTimeFormat, tsPart)
+		if err != nil {
+			continue
+		}
+		b.Time = t
+		if seqPart != "" {
+			if b.Seq, err = strconv.Atoi(seqPart); err != nil {
+				continue
+			}
+		}
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Time.Equal(out[j].Time) {
+			return out[i].Time.After(out[j].Time)
+		}
+		return out[i].Seq > out[j].Seq
+	})
+	return out, nil
+}
+
+func (u *Updater) readDirNames(dir string) ([]string, error) {
+	d, err := u.fs.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return d.Readdirnames(-1)
+}
+
+// pruneBackups applies the retention policy to path's backups.
+func (u *Updater) pruneBackups(path string) error {
+	r := u.retention
+	if r.KeepLast <= 0 && r.MaxAge <= 0 && r.CompressAfter <= 0 {
+		return nil
+	}
+	backups, err := u.ListBackups(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	var errs []string
+	for i, b := range backups {
+		switch {
+		case r.KeepLast > 0 && i >= r.KeepLast, r.MaxAge > 0 && now.Sub(b.Time) > r.MaxAge:
+			if err := u.fs.Remove(b.Path); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			slog.Debug("pruned backup", "backup", b.Path)
+			backupOps.WithLabelValues(path, "pruned").Inc()
+		case r.CompressAfter > 0 && i >= r.CompressAfter && !b.Compressed:
+			if err := u.compressBackup(b.Path); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			backupOps.WithLabelValues(path, "compressed").Inc()
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("prune backups: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// compressBackup gzips path to path.gz and removes the original.
+func (u *Updater) compressBackup(path string) error {
+	src, err := u.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	mode := os.FileMode(0o644)
+	if fi, err := src.Stat(); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	gzPath := path + ".gz"
+	_ = u.fs.Remove(gzPath) // left over from an interrupted earlier attempt
+	if err := u.writeSynced(gzPath, mode, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		if _, err := io.Copy(zw, src); err != nil {
+			return err
+		}
+		return zw.Close()
+	}); err != nil {
+		return err
+	}
+	return u.fs.Remove(path)
+}
@@ -0,0 +1,62 @@
+package serverclass
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestBackups_SameSecondAndRetention(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/ds/serverclass.conf", []byte("[serverClass:c]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// old backups from a previous run
+	old := time.Now().UTC().Add(-40 * 24 * time.Hour).Format(backupTimeFormat)
+	recent := time.Now().UTC().Add(-time.Hour).Format(backupTimeFormat)
+	for _, name := range []string{old + ".bak", recent + ".bak", recent + ".1.bak"} {
+		if err := afero.WriteFile(mem, "/bak/serverclass.conf."+name, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u := NewUpdater(Config{
+		Path:      "/ds/serverclass.conf",
+		Backup:    true,
+		BackupDir: "/bak",
+		Retention: Retention{KeepLast: 4, MaxAge: 30 * 24 * time.Hour, CompressAfter: 2},
+	})
+	u.SetFS(mem)
+	first, err := u.makeTimestampBackup("/ds/serverclass.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := u.makeTimestampBackup("/ds/serverclass.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("backups in the same second collided: %s", first)
+	}
+
+	backups, err := u.ListBackups("/ds/serverclass.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 4 {
+		t.Fatalf("expected 4 backups after pruning, got %+v", backups)
+	}
+	if backups[0].Path != second || backups[1].Path != first {
+		t.Fatalf("backups not newest first: %+v", backups)
+	}
+	for i, b := range backups {
+		if strings.HasPrefix(b.Path, "/bak/serverclass.conf."+old) {
+			t.Fatalf("backup older than max age kept: %s", b.Path)
+		}
+		if want := i >= 2; b.Compressed != want {
+			t.Fatalf("backup %d compressed=%v want %v: %s", i, b.Compressed, want, b.Path)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package serverclass
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Change is one whitelist update of a class: applied, or only proposed when DryRun is set.
+type Change struct {
+	Time    time.Time `json:"time"`
+	File    string    `json:"file"`
+	App     string    `json:"app"`
+	Class   string    `json:"class"`
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+	DryRun  bool      `json:"dryRun"`
+	// Backups are the copies taken of the files replaced by this change.
+	Backups []string `json:"backups,omitempty"`
+}
+
+// recordChange remembers a whitelist diff for TakeChanges and counts written ones.
+func (u *Updater) recordChange(app, class string, adds, removes []string, dryRun bool) {
+	backups := u.backupsTaken
+	u.backupsTaken = nil
+	if len(adds) == 0 && len(removes) == 0 {
+		return
+	}
+	adds = append([]string(nil), adds...)
+	removes = append([]string(nil), removes...)
+	sort.Strings(adds)
+	sort.Strings(removes)
+	u.changes = append(u.changes, Change{
+		Time:    time.Now().UTC(),
+		File:    u.path,
+		App:     app,
+		Class:   class,
+		Added:   adds,
+		Removed: removes,
+		DryRun:  dryRun,
+		Backups: backups,
+	})
+	if dryRun {
+		return
+	}
+	if len(adds) > 0 {
+		whitelistChanges.WithLabelValues(u.path, class, "add").Add(float64(len(adds)))
+	}
+	if len(removes) > 0 {
+		whitelistChanges.WithLabelValues(u.path, class, "remove").Add(float64(len(removes)))
+	}
+}
+
+// TakeChanges returns the changes recorded since the last call and forgets them.
+func (u *Updater) TakeChanges() []Change {
+	out := u.changes
+	u.changes = nil
+	return out
+}
+
+// Whitelist returns the class's whitelist as currently published by the updater: the
+// managed inline entries, or the host list file in pathname mode. Hand-managed entries
+// are not included.
+func (u *Updater) Whitelist(serverClass string) ([]string, error) {
+	if u.usePathname(serverClass) {
+		return u.readHostList(u.hostListPath(serverClass))
+	}
+	b, err := u.Current()
+	if err != nil {
+		return nil, err
+	}
+	sec := ParseConf(b).Stanza(fmt.Sprintf("serverClass:%s", serverClass))
+	if sec == nil {
+		return nil, nil
+	}
+	return u.collectWhitelist(sec), nil
+}
@@ -0,0 +1,314 @@
+package serverclass
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ConfFile is a Splunk .conf file parsed for in-place editing. Every physical line is kept
+// verbatim, so untouched stanzas, comments, blank lines, line continuations and unusual
+// keys are written back byte-for-byte; only keys changed through Set/Delete are re-rendered.
+type ConfFile struct {
+	// head holds lines before the first stanza header (the implicit default stanza).
+	head    *ConfStanza
+	stanzas []*ConfStanza
+}
+
+// ConfStanza is one [name] section of a ConfFile.
+type ConfStanza struct {
+	Name   string
+	header string // raw header line, empty for the implicit default stanza
+	lines  []confLine
+}
+
+// confLine is one logical line: a comment, a blank line, an opaque line, or a key/value
+// pair that may span several physical lines via trailing '\' continuations.
+type confLine struct {
+	raw   string // exact original text including line endings
+	key   string // empty unless this is a key/value line
+	value string // logical value; continuation lines joined with "\n"
+}
+
+// ParseConf parses Splunk .conf content. It never fails: lines it cannot interpret are
+// preserved as opaque text.
+func ParseConf(b []byte) *ConfFile {
+	f := &ConfFile{head: &ConfStanza{}}
+	cur := f.head
+	phys := splitLines(string(b))
+	for i := 0; i < len(phys); i++ {
+		raw := phys[i]
+		text := strings.TrimSpace(trimEOL(raw))
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+			cur.lines = append(cur.lines, confLine{raw: raw})
+		case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+			cur = &ConfStanza{Name: text[1 : len(text)-1], header: raw}
+			f.stanzas = append(f.stanzas, cur)
+		default:
+			eq := strings.IndexByte(text, '=')
+			if eq <= 0 {
+				cur.lines = append(cur.lines, confLine{raw: raw})
+				continue
+			}
+			l := confLine{raw: raw, key: strings.TrimSpace(text[:eq])}
+			parts := []string{strings.TrimSpace(text[eq+1:])}
+			// a trailing backslash continues the value on the next physical line
+			for strings.HasSuffix(parts[len(parts)-1], `\`) && i+1 < len(phys) {
+				last := parts[len(parts)-1]
+				parts[len(parts)-1] = strings.TrimRight(strings.TrimSuffix(last, `\`), " \t")
+				i++
+				l.raw += phys[i]
+				parts = append(parts, strings.TrimSpace(trimEOL(phys[i])))
+			}
+			l.value = strings.Join(parts, "\n")
+			cur.lines = append(cur.lines, l)
+		}
+	}
+	return f
+}
+
+// Bytes renders the file.
+func (f *ConfFile) Bytes() []byte {
+	var buf bytes.Buffer
+	f.head.writeTo(&buf)
+	for _, s := range f.stanzas {
+		s.writeTo(&buf)
+	}
+	return buf.Bytes()
+}
+
+func (s *ConfStanza) writeTo(buf *bytes.Buffer) {
+	buf.WriteString(s.header)
+	for _, l := range s.lines {
+		buf.WriteString(l.raw)
+	}
+}
+
+// Stanzas returns the file's stanzas in file order, excluding the implicit default stanza.
+func (f *ConfFile) Stanzas() []*ConfStanza { return f.stanzas }
+
+// Stanza returns the first stanza with the given name, or nil.
+func (f *ConfFile) Stanza(name string) *ConfStanza {
+	for _, s := range f.stanzas {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// AddStanza appends a new empty stanza, separated from the previous content by a blank line.
+func (f *ConfFile) AddStanza(name string) *ConfStanza {
+	var last *ConfStanza
+	if n := len(f.stanzas); n > 0 {
+		last = f.stanzas[n-1]
+	} else {
+		last = f.head
+	}
+	eol := f.eol()
+	if tail := string(f.Bytes()); tail != "" {
+		if !strings.HasSuffix(tail, "\n") {
+			last.appendRaw(eol)
+			tail += eol
+		}
+		if !strings.HasSuffix(tail, eol+eol) && !strings.HasSuffix(tail, "\n\n") {
+			last.appendRaw(eol)
+		}
+	}
+	s := &ConfStanza{Name: name, header: "[" + name + "]" + eol}
+	f.stanzas = append(f.stanzas, s)
+	return s
+}
+
+// appendRaw appends text to the stanza's last physical line (or header when empty).
+func (s *ConfStanza) appendRaw(text string) {
+	if n := len(s.lines); n > 0 && !strings.HasSuffix(s.lines[n-1].raw, "\n") {
+		s.lines[n-1].raw += text
+		return
+	}
+	if len(s.lines) == 0 && s.header != "" && !strings.HasSuffix(s.header, "\n") {
+		s.header += text
+		return
+	}
+	s.lines = append(s.lines, confLine{raw: text})
+}
+
+// eol returns the file's line ending, defaulting to "\n".
+func (f *ConfFile) eol() string {
+	if strings.Contains(string(f.Bytes()), "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// Keys returns the stanza's keys in file order.
+func (s *ConfStanza) Keys() []string {
+	var out []string
+	for _, l := range s.lines {
+		if l.key != "" {
+			out = append(out, l.key)
+		}
+	}
+	return out
+}
+
+// Get returns the value of the last occurrence of key (Splunk's last-wins semantics).
+func (s *ConfStanza) Get(key string) (string, bool) {
+	for i := len(s.lines) - 1; i >= 0; i-- {
+		if s.lines[i].key == key {
+			return s.lines[i].value, true
+		}
+	}
+	return "", false
+}
+
+// Has reports whether the stanza defines key.
+func (s *ConfStanza) Has(key string) bool {
+	_, ok := s.Get(key)
+	return ok
+}
+
+// Set updates key in place, keeping the original spacing around '='. A new key is inserted
+// after the last key of the same family (the part before the first '.'), or after the
+// stanza's last key, so trailing comments and blank lines stay where they were.
+func (s *ConfStanza) Set(key, value string) {
+	for i := len(s.lines) - 1; i >= 0; i-- {
+		l := &s.lines[i]
+		if l.key != key {
+			continue
+		}
+		if l.value == value {
+			return
+		}
+		l.raw = renderKey(l.raw, key, value)
+		l.value = value
+		return
+	}
+	at := s.insertPos(key)
+	eol := "\n"
+	if at > 0 && strings.HasSuffix(s.lines[at-1].raw, "\r\n") {
+		eol = "\r\n"
+	} else if at == 0 && strings.HasSuffix(s.header, "\r\n") {
+		eol = "\r\n"
+	}
+	// make sure the preceding line is terminated before inserting after it
+	if at > 0 && !strings.HasSuffix(s.lines[at-1].raw, "\n") {
+		s.lines[at-1].raw += eol
+	} else if at == 0 && s.header != "" && !strings.HasSuffix(s.header, "\n") {
+		s.header += eol
+	}
+	l := confLine{raw: renderKey("", key, value) + eol, key: key, value: value}
+	s.lines = append(s.lines, confLine{})
+	copy(s.lines[at+1:], s.lines[at:])
+	s.lines[at] = l
+}
+
+// HasComment reports whether the stanza body contains the full-line comment text
+// (compared after trimming surrounding whitespace).
+func (s *ConfStanza) HasComment(text string) bool {
+	for _, l := range s.lines {
+		if l.key == "" && strings.TrimSpace(l.raw) == text {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertComment adds a full-line comment directly after the stanza header.
+func (s *ConfStanza) InsertComment(text string) {
+	eol := "\n"
+	if strings.HasSuffix(s.header, "\r\n") {
+		eol = "\r\n"
+	} else if s.header != "" && !strings.HasSuffix(s.header, "\n") {
+		s.header += eol
+	}
+	s.lines = append([]confLine{{raw: text + eol}}, s.lines...)
+}
+
+// Delete removes every occurrence of key.
+func (s *ConfStanza) Delete(key string) {
+	out := s.lines[:0]
+	for _, l := range s.lines {
+		if l.key != key {
+			out = append(out, l)
+		}
+	}
+	s.lines = out
+}
+
+func (s *ConfStanza) insertPos(key string) int {
+	fam := keyFamily(key)
+	lastKey, lastFam := -1, -1
+	for i, l := range s.lines {
+		if l.key == "" {
+			continue
+		}
+		lastKey = i
+		if keyFamily(l.key) == fam {
+			lastFam = i
+		}
+	}
+	if lastFam >= 0 {
+		return lastFam + 1
+	}
+	if lastKey >= 0 {
+		return lastKey + 1
+	}
+	// no keys yet: go after any leading comments (e.g. an ownership marker)
+	at := 0
+	for at < len(s.lines) && strings.HasPrefix(strings.TrimSpace(s.lines[at].raw), "#") {
+		at++
+	}
+	return at
+}
+
+func keyFamily(key string) string {
+	if i := strings.IndexByte(key, '.'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// renderKey renders "key = value", reusing the "key<sp>=<sp>" prefix of orig when present.
+// Multi-line values are written with '\' continuations.
+func renderKey(orig, key, value string) string {
+	prefix := key + " = "
+	if first := trimEOL(firstLine(orig)); first != "" {
+		if eq := strings.IndexByte(first, '='); eq >= 0 {
+			rest := first[eq+1:]
+			prefix = first[:eq+1] + rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+		}
+	}
+	out := prefix + strings.ReplaceAll(value, "\n", "\\\n")
+	if orig != "" {
+		// keep the original line ending
+		out += orig[len(trimEOL(orig)):]
+	}
+	return out
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i+1]
+	}
+	return s
+}
+
+func trimEOL(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
+
+// splitLines splits s into physical lines, each keeping its line ending.
+func splitLines(s string) []string {
+	var out []string
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			out = append(out, s)
+			break
+		}
+		out = append(out, s[:i+1])
+		s = s[i+1:]
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package serverclass
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s mismatch\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func TestParseConf_RoundTrip(t *testing.T) {
+	for _, name := range []string{"serverclass.conf", "no_trailing_newline.conf", "crlf.conf"} {
+		in := readTestdata(t, name)
+		if got := ParseConf(in).Bytes(); !bytes.Equal(got, in) {
+			t.Fatalf("%s: round trip changed content\n--- got ---\n%q\n--- want ---\n%q", name, got, in)
+		}
+	}
+}
+
+func TestParseConf_Values(t *testing.T) {
+	f := ParseConf(readTestdata(t, "serverclass.conf"))
+	app := f.Stanza("serverClass:AA-DESTINATION-dest1-class:app:AA-DESTINATION-dest1")
+	if app == nil {
+		t.Fatal("app stanza not found")
+	}
+	if v, _ := app.Get("machineTypesFilter"); v != "linux-x86_64,\nwindows-x64" {
+		t.Fatalf("continuation value: got %q", v)
+	}
+	hand := f.Stanza("serverClass:hand-made")
+	if v, ok := hand.Get("odd key/with:chars"); !ok || v != "value with = sign" {
+		t.Fatalf("odd key: got %q %v", v, ok)
+	}
+	if v, _ := f.Stanza("serverClass:AA-DESTINATION-dest1-class").Get("whitelist.1001"); v != "old002" {
+		t.Fatalf("spaced key: got %q", v)
+	}
+}
+
+func TestUpdateWhitelist_Golden(t *testing.T) {
+	cases := []struct {
+		input, golden, class string
+		patterns             []string
+	}{
+		{"serverclass.conf", "serverclass.update.golden", "AA-DESTINATION-dest1-class", []string{"abc*", "def001", "xyz*"}},
+		{"serverclass.conf", "serverclass.newclass.golden", "AA-DESTINATION-dest2-class", []string{"xyz*"}},
+		{"no_trailing_newline.conf", "no_trailing_newline.update.golden", "no-newline", []string{"a*", "b*"}},
+		{"crlf.conf", "crlf.update.golden", "crlf", []string{"a*", "b*"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.golden, func(t *testing.T) {
+			mem := afero.NewMemMapFs()
+			if err := afero.WriteFile(mem, "/serverclass.conf", readTestdata(t, tc.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			u := NewUpdater(Config{Path: "/serverclass.conf"})
+			u.SetFS(mem)
+			if err := u.UpdateWhitelist("app", tc.class, tc.patterns); err != nil {
+				t.Fatal(err)
+			}
+			got, err := afero.ReadFile(mem, "/serverclass.conf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tc.golden, got)
+		})
+	}
+}
+
+func TestUpdateWhitelist_OnlyTouchesOwnedKeys(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/serverclass.conf", readTestdata(t, "serverclass.conf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u := NewUpdater(Config{Path: "/serverclass.conf"})
+	u.SetFS(mem)
+	if err := u.UpdateWhitelist("app", "AA-DESTINATION-dest1-class", []string{"abc*"}); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := afero.ReadFile(mem, "/serverclass.conf")
+	sec := ParseConf(b).Stanza("serverClass:AA-DESTINATION-dest1-class")
+	if v, _ := sec.Get("whitelist.0"); v != "hand-added01" {
+		t.Fatalf("hand-managed entry changed: %q", v)
+	}
+	if v, _ := sec.Get("whitelist.1000"); v != "abc*" {
+		t.Fatalf("managed entry not updated: %q", v)
+	}
+	if sec.Has("whitelist.1001") || sec.Has("whitelist.1002") {
+		t.Fatalf("surplus managed entries not removed:\n%s", b)
+	}
+}
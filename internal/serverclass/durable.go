@@ -0,0 +1,122 @@
+package serverclass
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// writeFile backs up path (if enabled and it exists) and atomically replaces it with data.
+// The temp file is fsynced before the rename and the directory after it, so a crash leaves
+// either the old or the new content, never a truncated file. The original file's mode and
+// (where permitted) ownership are carried over.
+func (u *Updater) writeFile(path string, data []byte) error {
+	if err := u.fs.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	var orig os.FileInfo
+	if fi, statErr := u.fs.Stat(path); statErr == nil {
+		orig = fi
+		mode = fi.Mode().Perm()
+		// Perform timestamped backup (copy) if enabled and target exists
+		if u.backup {
+			b, err := u.makeTimestampBackup(path)
+			if err != nil {
+				return err
+			}
+			u.backupsTaken = append(u.backupsTaken, b)
+		}
+	}
+
+	// Write to a temp file then atomically replace
+	ts := time.Now().UTC().Format("20060102-150405")
+	tmpPath := fmt.Sprintf("%s.tmp-%d-%s", path, os.Getpid(), ts)
+	if err := u.writeSynced(tmpPath, mode, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return err
+	}
+	if orig != nil {
+		u.copyOwner(orig, tmpPath)
+	}
+	if rerr := u.fs.Rename(tmpPath, path); rerr != nil {
+		// rollback: original file still intact (we only wrote temp). Cleanup temp and bubble error
+		_ = u.fs.Remove(tmpPath)
+		return rerr
+	}
+	u.syncDir(filepath.Dir(path))
+	lastWrite.WithLabelValues(path).SetToCurrentTime()
+	return nil
+}
+
+// writeSynced creates path exclusively with mode, fills it via fill, fsyncs and closes it.
+// On any error the file is removed.
+func (u *Updater) writeSynced(path string, mode os.FileMode, fill func(io.Writer) error) error {
+	f, err := u.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	werr := fill(f)
+	if werr == nil {
+		werr = f.Sync()
+	}
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		// the umask may have narrowed the create mode
+		werr = u.fs.Chmod(path, mode)
+	}
+	if werr != nil {
+		_ = u.fs.Remove(path)
+		return werr
+	}
+	return nil
+}
+
+// syncDir fsyncs a directory so a rename or create in it survives a crash. Failures are
+// logged, not returned: the data itself is already durable and in place.
+func (u *Updater) syncDir(dir string) {
+	d, err := u.fs.Open(dir)
+	if err != nil {
+		slog.Warn("fsync directory failed", "dir", dir, "err", err)
+		return
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		slog.Warn("fsync directory failed", "dir", dir, "err", err)
+	}
+}
+
+// copyOwner gives path the owner and group of orig. Changing ownership usually requires
+// privileges, so a failure is logged and the write continues.
+func (u *Updater) copyOwner(orig os.FileInfo, path string) {
+	uid, gid, ok := fileOwner(orig)
+	if !ok {
+		return
+	}
+	if err := u.fs.Chown(path, uid, gid); err != nil {
+		slog.Warn("could not preserve file ownership", "file", path, "uid", uid, "gid", gid, "err", err)
+	}
+}
+
+// CheckWritable verifies that serverclass.conf can be replaced: its directory accepts a new
+// file (which is how writeFile replaces it). Nothing is left behind.
+func (u *Updater) CheckWritable() error {
+	dir := filepath.Dir(u.path)
+	if _, err := u.fs.Stat(dir); err != nil {
+		return err
+	}
+	probe := filepath.Join(dir, fmt.Sprintf(".%s.probe-%d", filepath.Base(u.path), os.Getpid()))
+	f, err := u.fs.OpenFile(probe, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return u.fs.Remove(probe)
+}
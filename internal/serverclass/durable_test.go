@@ -0,0 +1,147 @@
+package serverclass
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+var errInjected = errors.New("injected fault")
+
+// faultFs wraps an afero.Fs, failing the selected operation on files whose name contains
+// ".tmp-" and recording the order of syncs and renames.
+type faultFs struct {
+	afero.Fs
+	fail string // "write", "sync", "close" or "rename"
+	ops  []string
+}
+
+type faultFile struct {
+	afero.File
+	fs *faultFs
+}
+
+func (f *faultFs) temp(name string) bool { return strings.Contains(name, ".tmp-") }
+
+func (f *faultFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := f.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+func (f *faultFs) Open(name string) (afero.File, error) {
+	file, err := f.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+func (f *faultFs) Rename(oldname, newname string) error {
+	if f.fail == "rename" && f.temp(oldname) {
+		return errInjected
+	}
+	f.ops = append(f.ops, "rename "+newname)
+	return f.Fs.Rename(oldname, newname)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if f.fs.fail == "write" && f.fs.temp(f.Name()) {
+		// a short write, as on a full disk
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, errInjected
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) Sync() error {
+	if f.fs.fail == "sync" && f.fs.temp(f.Name()) {
+		return errInjected
+	}
+	f.fs.ops = append(f.fs.ops, "sync "+f.Name())
+	return f.File.Sync()
+}
+
+func (f *faultFile) Close() error {
+	err := f.File.Close()
+	if f.fs.fail == "close" && f.fs.temp(f.Name()) {
+		return errInjected
+	}
+	return err
+}
+
+func TestWriteFile_FaultsLeaveOriginalIntact(t *testing.T) {
+	const original = "[serverClass:c]\nwhitelist.0 = keep\n"
+	for _, fail := range []string{"write", "sync", "close", "rename"} {
+		t.Run(fail, func(t *testing.T) {
+			mem := afero.NewMemMapFs()
+			if err := afero.WriteFile(mem, "/etc/serverclass.conf", []byte(original), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			u := NewUpdater(Config{Path: "/etc/serverclass.conf"})
+			u.SetFS(&faultFs{Fs: mem, fail: fail})
+
+			if err := u.writeFile(u.path, []byte("[serverClass:c]\n")); !errors.Is(err, errInjected) {
+				t.Fatalf("expected injected error, got %v", err)
+			}
+			if b, _ := afero.ReadFile(mem, u.path); string(b) != original {
+				t.Fatalf("original changed:\n%s", b)
+			}
+			names, _ := afero.ReadDir(mem, "/etc")
+			for _, fi := range names {
+				if strings.Contains(fi.Name(), ".tmp-") {
+					t.Fatalf("temp file %s left behind", fi.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFile_SyncsAndPreservesMode(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/etc/serverclass.conf", []byte("old\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	ffs := &faultFs{Fs: mem}
+	u := NewUpdater(Config{Path: "/etc/serverclass.conf", Backup: true})
+	u.SetFS(ffs)
+
+	if err := u.writeFile(u.path, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := mem.Stat(u.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o640 {
+		t.Fatalf("mode not preserved: %v", fi.Mode().Perm())
+	}
+	backups, _ := u.ListBackups(u.path)
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v", backups)
+	}
+	if bi, _ := mem.Stat(backups[0].Path); bi.Mode().Perm() != 0o640 {
+		t.Fatalf("backup mode not preserved: %v", bi.Mode().Perm())
+	}
+
+	// backup synced, temp synced before the rename, directory synced after it
+	var tempSync, rename, dirSync = -1, -1, -1
+	for i, op := range ffs.ops {
+		switch {
+		case strings.HasPrefix(op, "sync ") && strings.Contains(op, ".tmp-"):
+			tempSync = i
+		case op == "rename /etc/serverclass.conf":
+			rename = i
+		case op == "sync /etc" && rename >= 0:
+			dirSync = i
+		}
+	}
+	if tempSync < 0 || rename < tempSync || dirSync < rename {
+		t.Fatalf("unexpected operation order: %q", ffs.ops)
+	}
+}
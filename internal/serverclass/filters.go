@@ -0,0 +1,150 @@
+package serverclass
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/example/splunk-ds-camr/internal/patterns"
+)
+
+var errUnresolvedPath = errors.New("relative from_pathname cannot be resolved")
+
+// FilterEntry is one whitelist or blacklist pattern of a class and where it comes from.
+type FilterEntry struct {
+	Key     string `json:"key"` // e.g. whitelist.1000, or whitelist.from_pathname for host list lines
+	Pattern string `json:"pattern"`
+	Managed bool   `json:"managed"` // written by the updater
+
+	re *regexp.Regexp
+}
+
+// Match reports whether the entry matches any of names (client name, hostname, IP
+// address or DNS name) the way the deployment server does; see patterns.Compile.
+func (e FilterEntry) Match(names ...string) bool {
+	re := e.re
+	if re == nil {
+		re = patterns.Compile(e.Pattern)
+	}
+	for _, n := range names {
+		if n != "" && re.MatchString(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassFilter is the whitelist and blacklist of one [serverClass:<name>] stanza as
+// currently published in serverclass.conf and its host list files.
+type ClassFilter struct {
+	Class      string        `json:"class"`
+	FilterType string        `json:"filterType"` // whitelist (default) or blacklist
+	Whitelist  []FilterEntry `json:"whitelist"`
+	Blacklist  []FilterEntry `json:"blacklist"`
+	// Unresolved lists from_pathname files that could not be read (e.g. relative to
+	// $SPLUNK_HOME and not written by the updater).
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// Evaluate returns the whitelist and blacklist entries matching any of names and whether
+// the class applies to the client. With filterType whitelist a client must match the
+// whitelist and not the blacklist; with blacklist it is included unless it matches the
+// blacklist and not the whitelist.
+func (f ClassFilter) Evaluate(names ...string) (wl, bl []FilterEntry, included bool) {
+	for _, e := range f.Whitelist {
+		if e.Match(names...) {
+			wl = append(wl, e)
+		}
+	}
+	for _, e := range f.Blacklist {
+		if e.Match(names...) {
+			bl = append(bl, e)
+		}
+	}
+	if f.FilterType == "blacklist" {
+		return wl, bl, len(bl) == 0 || len(wl) > 0
+	}
+	return wl, bl, len(wl) > 0 && len(bl) == 0
+}
+
+// ClassFilters returns the filters of every class stanza in serverclass.conf, sorted by
+// class. App sub-stanzas are not included; filterType is inherited from [global] and
+// repeated stanzas of a class are merged, as Splunk does.
+func (u *Updater) ClassFilters() ([]ClassFilter, error) {
+	b, err := u.Current()
+	if err != nil {
+		return nil, err
+	}
+	conf := ParseConf(b)
+	defaultType := "whitelist"
+	if g := conf.Stanza("global"); g != nil {
+		if v, ok := g.Get("filterType"); ok && strings.TrimSpace(v) != "" {
+			defaultType = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+	byClass := map[string]*ClassFilter{}
+	for _, sec := range conf.Stanzas() {
+		class, ok := strings.CutPrefix(sec.Name, "serverClass:")
+		if !ok || strings.Contains(class, ":app:") {
+			continue
+		}
+		cf := byClass[class]
+		if cf == nil {
+			cf = &ClassFilter{Class: class, FilterType: defaultType}
+			byClass[class] = cf
+		}
+		if v, ok := sec.Get("filterType"); ok && strings.TrimSpace(v) != "" {
+			cf.FilterType = strings.ToLower(strings.TrimSpace(v))
+		}
+		for _, k := range sec.Keys() {
+			kind, idx, ok := strings.Cut(k, ".")
+			if !ok || (kind != "whitelist" && kind != "blacklist") {
+				continue
+			}
+			v, _ := sec.Get(k)
+			var entries []FilterEntry
+			if idx == "from_pathname" {
+				list, managed, err := u.resolveHostList(class, v)
+				if err != nil {
+					cf.Unresolved = append(cf.Unresolved, v)
+					continue
+				}
+				for _, p := range list {
+					entries = append(entries, FilterEntry{Key: k, Pattern: p, Managed: managed, re: patterns.Compile(p)})
+				}
+			} else {
+				entries = []FilterEntry{{Key: k, Pattern: v, Managed: kind == "whitelist" && u.isManagedWhitelistKey(k), re: patterns.Compile(v)}}
+			}
+			if kind == "whitelist" {
+				cf.Whitelist = append(cf.Whitelist, entries...)
+			} else {
+				cf.Blacklist = append(cf.Blacklist, entries...)
+			}
+		}
+	}
+	out := make([]ClassFilter, 0, len(byClass))
+	for _, cf := range byClass {
+		out = append(out, *cf)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Class < out[j].Class })
+	return out, nil
+}
+
+// resolveHostList reads the file a from_pathname key points at: the updater's own host
+// list for the class, or any absolute path.
+func (u *Updater) resolveHostList(class, ref string) ([]string, bool, error) {
+	if u.hostListDir != "" && ref == u.hostListRef(class) {
+		list, err := u.readHostList(u.hostListPath(class))
+		return list, true, err
+	}
+	if !filepath.IsAbs(ref) {
+		return nil, false, errUnresolvedPath
+	}
+	if _, err := u.fs.Stat(ref); err != nil {
+		return nil, false, err
+	}
+	list, err := u.readHostList(ref)
+	return list, false, err
+}
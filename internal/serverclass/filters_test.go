@@ -0,0 +1,29 @@
+package serverclass
+
+import "testing"
+
+func TestClassFilterEvaluate(t *testing.T) {
+	wl := []FilterEntry{{Key: "whitelist.0", Pattern: "web*"}}
+	bl := []FilterEntry{{Key: "blacklist.0", Pattern: "web9*"}}
+	f := ClassFilter{Class: "c", FilterType: "whitelist", Whitelist: wl, Blacklist: bl}
+	if _, _, ok := f.Evaluate("web01"); !ok {
+		t.Fatal("web01 should be included")
+	}
+	if _, _, ok := f.Evaluate("web91"); ok {
+		t.Fatal("blacklist should override the whitelist")
+	}
+	if _, _, ok := f.Evaluate("db01", "10.0.0.1"); ok {
+		t.Fatal("db01 should not be included")
+	}
+
+	f = ClassFilter{Class: "c", FilterType: "blacklist", Whitelist: []FilterEntry{{Pattern: "db01"}}, Blacklist: []FilterEntry{{Pattern: "db*"}}}
+	if _, _, ok := f.Evaluate("web01"); !ok {
+		t.Fatal("blacklist filter type should include unmatched clients")
+	}
+	if _, _, ok := f.Evaluate("db02"); ok {
+		t.Fatal("db02 should be excluded")
+	}
+	if _, _, ok := f.Evaluate("db01"); !ok {
+		t.Fatal("whitelist should override the blacklist with filterType blacklist")
+	}
+}
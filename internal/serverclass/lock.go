@@ -0,0 +1,165 @@
+package serverclass
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// ErrLocked is returned when another instance holds the lock and the wait time ran out.
+var ErrLocked = errors.New("locked by another instance")
+
+// ErrModifiedExternally is returned when the file changed between read and write.
+var ErrModifiedExternally = errors.New("modified externally since it was read")
+
+// LockOptions control the advisory lock taken around an update cycle.
+type LockOptions struct {
+	Wait       time.Duration // how long to wait for a held lock (0 = fail immediately)
+	StaleAfter time.Duration // treat locks older than this as stale (0 = only dead PIDs)
+}
+
+// lockInfo is the content of the lock file.
+type lockInfo struct {
+	PID   int       `json:"pid"`
+	Host  string    `json:"host"`
+	Since time.Time `json:"since"`
+}
+
+const lockPollInterval = 250 * time.Millisecond
+
+// breakLockStale is how old a leftover <file>.lock.break (from a process that crashed
+// while breaking a lock) may get before it is removed.
+const breakLockStale = 30 * time.Second
+
+func (u *Updater) lockPath() string { return u.path + ".lock" }
+
+func (u *Updater) breakLockPath() string { return u.path + ".lock.break" }
+
+// Lock takes the advisory lock on serverclass.conf (a <file>.lock created exclusively and
+// holding our PID). A lock whose process is gone (same host) or that is older than
+// StaleAfter is removed as stale, see breakStale. The returned function releases the lock.
+func (u *Updater) Lock(ctx context.Context) (func(), error) {
+	if err := u.fs.MkdirAll(filepath.Dir(u.path), 0o755); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	me := lockInfo{PID: os.Getpid(), Host: host, Since: time.Now().UTC()}
+	deadline := time.Now().Add(u.lockOpts.Wait)
+	for {
+		f, err := u.fs.OpenFile(u.lockPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			werr := json.NewEncoder(f).Encode(me)
+			if cerr := f.Close(); werr == nil {
+				werr = cerr
+			}
+			if werr != nil {
+				_ = u.fs.Remove(u.lockPath())
+				return nil, werr
+			}
+			return func() { u.unlock(me) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		holder, raw, stale := u.staleLock(host)
+		if stale {
+			broken, err := u.breakStale(raw)
+			if err != nil {
+				return nil, err
+			}
+			if broken {
+				slog.Warn("removed stale lock", "lock", u.lockPath(), "pid", holder.PID, "host", holder.Host, "since", holder.Since)
+				continue
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%s: %w (pid %d on %s since %s)", u.path, ErrLocked, holder.PID, holder.Host, holder.Since.Format(time.RFC3339))
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// staleLock reads the current lock and reports whether it may be broken, along with the
+// raw content breakStale must find unchanged. A vanished lock has nil content.
+func (u *Updater) staleLock(host string) (lockInfo, []byte, bool) {
+	var li lockInfo
+	b, err := afero.ReadFile(u.fs, u.lockPath())
+	if err != nil {
+		// vanished in the meantime: retry immediately
+		return li, nil, os.IsNotExist(err)
+	}
+	if err := json.Unmarshal(b, &li); err != nil {
+		// half-written by a crashed process; only break it once it is old enough
+		if fi, serr := u.fs.Stat(u.lockPath()); serr == nil {
+			li.Since = fi.ModTime()
+		}
+		return li, b, u.lockOpts.StaleAfter > 0 && time.Since(li.Since) > u.lockOpts.StaleAfter
+	}
+	if u.lockOpts.StaleAfter > 0 && time.Since(li.Since) > u.lockOpts.StaleAfter {
+		return li, b, true
+	}
+	return li, b, li.Host == host && !processAlive(li.PID)
+}
+
+// breakStale removes the lock if it still holds exactly stale (nil: nothing to remove).
+// The check and the removal run under <file>.lock.break, taken exclusively: otherwise two
+// waiters could both find the lock stale, and the second would remove the fresh lock the
+// first just took. It reports whether the caller should retry taking the lock now; false
+// means another process is breaking it.
+func (u *Updater) breakStale(stale []byte) (bool, error) {
+	if stale == nil {
+		return true, nil
+	}
+	f, err := u.fs.OpenFile(u.breakLockPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if !os.IsExist(err) {
+			return false, err
+		}
+		// left behind by a crash while breaking: clear it for the next attempt
+		if fi, serr := u.fs.Stat(u.breakLockPath()); serr == nil && time.Since(fi.ModTime()) > breakLockStale {
+			_ = u.fs.Remove(u.breakLockPath())
+		}
+		return false, nil
+	}
+	_ = f.Close()
+	defer func() { _ = u.fs.Remove(u.breakLockPath()) }()
+
+	cur, err := afero.ReadFile(u.fs, u.lockPath())
+	if err != nil {
+		// already gone
+		return os.IsNotExist(err), nil
+	}
+	if !bytes.Equal(cur, stale) {
+		// taken over in the meantime: a live lock again
+		return true, nil
+	}
+	if err := u.fs.Remove(u.lockPath()); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// unlock removes the lock file if it is still ours.
+func (u *Updater) unlock(me lockInfo) {
+	b, err := afero.ReadFile(u.fs, u.lockPath())
+	if err != nil {
+		return
+	}
+	var li lockInfo
+	if json.Unmarshal(b, &li) == nil && li.PID == me.PID && li.Host == me.Host && li.Since.Equal(me.Since) {
+		_ = u.fs.Remove(u.lockPath())
+	}
+}
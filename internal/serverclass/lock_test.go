@@ -0,0 +1,145 @@
+package serverclass
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func writeLock(t *testing.T, fs afero.Fs, path string, li lockInfo) {
+	t.Helper()
+	b, _ := json.Marshal(li)
+	if err := afero.WriteFile(fs, path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLock_HeldStaleAndReleased(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	u := NewUpdater(Config{Path: "/serverclass.conf", Lock: LockOptions{Wait: 300 * time.Millisecond}})
+	u.SetFS(mem)
+	host, _ := os.Hostname()
+
+	// held by a live process (ourselves, as another instance would be)
+	writeLock(t, mem, "/serverclass.conf.lock", lockInfo{PID: os.Getpid(), Host: host, Since: time.Now()})
+	if _, err := u.Lock(context.Background()); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	// held by a process that has exited: stale, broken and taken over
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("cannot start helper process:", err)
+	}
+	writeLock(t, mem, "/serverclass.conf.lock", lockInfo{PID: cmd.Process.Pid, Host: host, Since: time.Now()})
+	unlock, err := u.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("stale lock not broken: %v", err)
+	}
+	unlock()
+	if ok, _ := afero.Exists(mem, "/serverclass.conf.lock"); ok {
+		t.Fatal("lock file not removed on unlock")
+	}
+}
+
+func TestLock_ConcurrentWaitersBreakStaleLockOnce(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "serverclass.conf")
+	host, _ := os.Hostname()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("cannot start helper process:", err)
+	}
+	// a stale lock on the real filesystem, where O_EXCL is atomic
+	writeLock(t, afero.NewOsFs(), path+".lock", lockInfo{PID: cmd.Process.Pid, Host: host, Since: time.Now()})
+
+	var holders, maxHolders, done atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// one updater per waiter, as separate instances would have; later waiters
+			// remove the lock later, after earlier ones have taken it anew
+			u := NewUpdater(Config{Path: path, Lock: LockOptions{Wait: 10 * time.Second}})
+			u.SetFS(slowRemoveFs{Fs: afero.NewOsFs(), path: path + ".lock", delay: time.Duration(i+1) * 30 * time.Millisecond})
+			<-start
+			unlock, err := u.Lock(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := holders.Add(1)
+			for {
+				m := maxHolders.Load()
+				if n <= m || maxHolders.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(100 * time.Millisecond)
+			holders.Add(-1)
+			unlock()
+			done.Add(1)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	if maxHolders.Load() != 1 {
+		t.Fatalf("%d waiters held the lock at once", maxHolders.Load())
+	}
+	if done.Load() != 8 {
+		t.Fatalf("only %d of 8 waiters got the lock", done.Load())
+	}
+	if ok, _ := afero.Exists(afero.NewOsFs(), path+".lock.break"); ok {
+		t.Fatal("break lock left behind")
+	}
+}
+
+// slowRemoveFs delays removals of one file.
+type slowRemoveFs struct {
+	afero.Fs
+	path  string
+	delay time.Duration
+}
+
+func (fs slowRemoveFs) Remove(name string) error {
+	if name == fs.path {
+		time.Sleep(fs.delay)
+	}
+	return fs.Fs.Remove(name)
+}
+
+func TestWrite_AbortsOnExternalModification(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/serverclass.conf", []byte("[serverClass:c]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u := NewUpdater(Config{Path: "/serverclass.conf"})
+	u.SetFS(mem)
+	cfg, err := u.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Stanza("serverClass:c").Set("whitelist.1000", "abc*")
+	// another writer gets in between read and write
+	if err := afero.WriteFile(mem, "/serverclass.conf", []byte("[serverClass:c]\nwhitelist.0 = hand\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.write(cfg); !errors.Is(err, ErrModifiedExternally) {
+		t.Fatalf("expected ErrModifiedExternally, got %v", err)
+	}
+	b, _ := afero.ReadFile(mem, "/serverclass.conf")
+	if string(b) != "[serverClass:c]\nwhitelist.0 = hand\n" {
+		t.Fatalf("external edit was overwritten:\n%s", b)
+	}
+}
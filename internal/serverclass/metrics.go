@@ -0,0 +1,15 @@
+package serverclass
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	whitelistChanges = promauto.NewCounterVec(prometheus.CounterOpts{Name: "camr_whitelist_changes_total",
+		Help: "Whitelist patterns added or removed per class, counted when written."}, []string{"file", "class", "op"})
+	lastWrite = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "camr_last_write_timestamp_seconds",
+		Help: "Unix time of the last successful write of a managed file."}, []string{"file"})
+	backupOps = promauto.NewCounterVec(prometheus.CounterOpts{Name: "camr_backups_total",
+		Help: "Backups created, pruned or compressed per managed file."}, []string{"file", "action"})
+)
@@ -0,0 +1,53 @@
+package serverclass
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ManagedByMarker is the comment that marks a stanza as owned by the updater. Stanzas the
+// updater creates carry it; a hand-made stanza can be handed over by adding it.
+const ManagedByMarker = "# managed-by: splunk-ds-camr"
+
+// DefaultManagedIndexBase is the first whitelist index reserved for the updater. Entries
+// below it (whitelist.0 .. whitelist.999) belong to humans and are never modified.
+const DefaultManagedIndexBase = 1000
+
+// whitelistIndex parses a whitelist.N key. Special keys such as whitelist.from_pathname
+// are not indexed entries.
+func whitelistIndex(key string) (int, bool) {
+	rest, ok := strings.CutPrefix(key, "whitelist.")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(rest)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// isManagedWhitelistKey reports whether key is an indexed whitelist entry in the updater's range.
+func (u *Updater) isManagedWhitelistKey(key string) bool {
+	n, ok := whitelistIndex(key)
+	return ok && n >= u.managedBase
+}
+
+func (u *Updater) managedWhitelistKey(i int) string {
+	return "whitelist." + strconv.Itoa(u.managedBase+i)
+}
+
+// unmanagedWhitelist returns the indexed whitelist keys in sec that the updater does not own.
+func (u *Updater) unmanagedWhitelist(sec *ConfStanza) []string {
+	var keys []string
+	for _, k := range sec.Keys() {
+		if _, ok := whitelistIndex(k); ok && !u.isManagedWhitelistKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func isOwned(sec *ConfStanza) bool {
+	return sec.HasComment(ManagedByMarker)
+}
@@ -0,0 +1,219 @@
+package serverclass
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const fromPathnameKey = "whitelist.from_pathname"
+
+// Whitelist output modes.
+const (
+	ModeInline   = "inline"   // whitelist.N entries in serverclass.conf (default)
+	ModePathname = "pathname" // per-class host list file referenced by whitelist.from_pathname
+)
+
+// usePathname reports whether serverClass is written as a host list file.
+func (u *Updater) usePathname(serverClass string) bool {
+	if u.whitelistMode != ModePathname {
+		return false
+	}
+	return len(u.pathnameClasses) == 0 || contains(u.pathnameClasses, serverClass)
+}
+
+// hostListFile returns the file name used for a class. Unsafe characters are replaced
+// and a short hash of the class name is appended then, so that e.g. a/b and a_b do not
+// share a file.
+func hostListFile(serverClass string) string {
+	b := []byte(serverClass)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			b[i] = '_'
+		}
+	}
+	if string(b) != serverClass {
+		sum := sha256.Sum256([]byte(serverClass))
+		return fmt.Sprintf("%s-%x.txt", b, sum[:4])
+	}
+	return string(b) + ".txt"
+}
+
+// hostListPath is where the updater writes the class's host list.
+func (u *Updater) hostListPath(serverClass string) string {
+	return filepath.Join(u.hostListDir, hostListFile(serverClass))
+}
+
+// hostListRef is the value written to whitelist.from_pathname (as Splunk resolves it).
+func (u *Updater) hostListRef(serverClass string) string {
+	ref := u.hostListRefDir
+	if ref == "" {
+		ref = u.hostListDir
+	}
+	return filepath.Join(ref, hostListFile(serverClass))
+}
+
+// readHostList returns the entries of a host list file, or nil if it does not exist.
+func (u *Updater) readHostList(path string) ([]string, error) {
+	b, err := afero.ReadFile(u.fs, path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, l := range strings.Split(string(b), "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+			out = append(out, l)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// updateHostList writes the class's patterns to its host list file and points the stanza at
+// it, replacing any inline entries the updater owned.
+func (u *Updater) updateHostList(app, serverClass string, patterns []string) error {
+	listPath := u.hostListPath(serverClass)
+	ref := u.hostListRef(serverClass)
+	sort.Strings(patterns)
+
+	fileEntries, err := u.readHostList(listPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := u.load()
+	if err != nil {
+		return err
+	}
+	secName := fmt.Sprintf("serverClass:%s", serverClass)
+	sec := cfg.Stanza(secName)
+	if sec == nil {
+		sec = cfg.AddStanza(secName)
+		sec.InsertComment(ManagedByMarker)
+	}
+
+	// Previous whitelist is whatever the tool published, in the file or inline
+	prev := dedupeSorted(append(append([]string(nil), fileEntries...), u.collectWhitelist(sec)...))
+	adds, removes := diffSets(prev, patterns)
+
+	confChanged := false
+	if cur, ok := sec.Get(fromPathnameKey); !ok || cur != ref {
+		if ok && !isOwned(sec) {
+			return fmt.Errorf("class %s: %s is set by hand to %q; refusing to replace it", serverClass, fromPathnameKey, cur)
+		}
+		sec.Set(fromPathnameKey, ref)
+		confChanged = true
+	}
+	// inline managed entries are superseded by the host list
+	for _, k := range sec.Keys() {
+		if u.isManagedWhitelistKey(k) {
+			sec.Delete(k)
+			confChanged = true
+		}
+	}
+	if unmanaged := u.unmanagedWhitelist(sec); len(unmanaged) > 0 {
+		slog.Warn("unmanaged whitelist entries in managed class",
+			"app", app,
+			"class", serverClass,
+			"keys", unmanaged,
+			"managedIndexBase", u.managedBase,
+			"file", u.path,
+		)
+	}
+
+	_, statErr := u.fs.Stat(listPath)
+	listChanged := len(adds) > 0 || len(removes) > 0 || os.IsNotExist(statErr)
+
+	effectiveDryRun := u.dryRun || contains(u.dryRunApps, app)
+	if effectiveDryRun {
+		slog.Info("dry-run whitelist update",
+			"app", app,
+			"class", serverClass,
+			"+adds", len(adds),
+			"-removes", len(removes),
+			"hostList", listPath,
+			"confChanged", confChanged,
+			"file", u.path,
+		)
+		u.recordChange(app, serverClass, adds, removes, true)
+		return nil
+	}
+	if !listChanged && !confChanged {
+		slog.Info("noop whitelist update", "app", app, "class", serverClass)
+		return nil
+	}
+	// list first, so the stanza never references a missing or stale file
+	if listChanged {
+		prevList, readErr := afero.ReadFile(u.fs, listPath)
+		if readErr != nil && !os.IsNotExist(readErr) {
+			return readErr
+		}
+		var b strings.Builder
+		for _, p := range patterns {
+			b.WriteString(p)
+			b.WriteByte('\n')
+		}
+		if err := u.writeFile(listPath, []byte(b.String())); err != nil {
+			return err
+		}
+		if confChanged {
+			if err := u.write(cfg); err != nil {
+				// keep the list matching the serverclass.conf that references it
+				return errors.Join(err, u.restoreHostList(listPath, prevList, readErr == nil))
+			}
+		}
+	} else if confChanged {
+		if err := u.write(cfg); err != nil {
+			return err
+		}
+	}
+	u.recordChange(app, serverClass, adds, removes, false)
+	return nil
+}
+
+// restoreHostList puts back the content a host list had before a failed update, or
+// removes it if it did not exist.
+func (u *Updater) restoreHostList(path string, prev []byte, existed bool) error {
+	if !existed {
+		if err := u.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove host list %s: %w", path, err)
+		}
+		return nil
+	}
+	if err := u.writeFile(path, prev); err != nil {
+		return fmt.Errorf("restore host list %s: %w", path, err)
+	}
+	return nil
+}
+
+// dropOwnHostListRef removes whitelist.from_pathname from an owned stanza when it points
+// at the updater's own host list, used when a class goes back to inline mode.
+func (u *Updater) dropOwnHostListRef(sec *ConfStanza, serverClass string) bool {
+	if u.hostListDir == "" || !isOwned(sec) {
+		return false
+	}
+	if cur, ok := sec.Get(fromPathnameKey); ok && cur == u.hostListRef(serverClass) {
+		sec.Delete(fromPathnameKey)
+		return true
+	}
+	return false
+}
+
+func dedupeSorted(in []string) []string {
+	sort.Strings(in)
+	out := in[:0]
+	for i, v := range in {
+		if i == 0 || v != in[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,24 @@
+package serverclass
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+)
+
+// Reload asks the deployment server to re-read its configuration by running the configured
+// reload command (e.g. `splunk reload deploy-server`).
+func (u *Updater) Reload(ctx context.Context) error {
+	if len(u.reloadCommand) == 0 {
+		return fmt.Errorf("no reload command configured for %s", u.path)
+	}
+	cmd := exec.CommandContext(ctx, u.reloadCommand[0], u.reloadCommand[1:]...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("reload %q: %w: %s", strings.Join(u.reloadCommand, " "), err, strings.TrimSpace(string(out)))
+	}
+	slog.Info("deployment server reloaded", "file", u.path, "command", u.reloadCommand)
+	return nil
+}
@@ -0,0 +1,122 @@
+package serverclass
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// PauseState is stored next to a managed file while automatic updates are paused.
+type PauseState struct {
+	Since        time.Time `json:"since"`
+	Reason       string    `json:"reason"`
+	RestoredFrom string    `json:"restoredFrom,omitempty"`
+}
+
+// Path returns the serverclass.conf path managed by the updater.
+func (u *Updater) Path() string { return u.path }
+
+func (u *Updater) pausePath() string { return u.path + ".paused" }
+
+// Current returns the current content of serverclass.conf (empty if it does not exist).
+func (u *Updater) Current() ([]byte, error) {
+	b, err := afero.ReadFile(u.fs, u.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// ReadBackup returns the content of a backup, decompressing .gz backups.
+func (u *Updater) ReadBackup(b Backup) ([]byte, error) {
+	raw, err := afero.ReadFile(u.fs, b.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !b.Compressed {
+		return raw, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("read backup %s: %w", b.Path, err)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// ErrRestorePathname is returned by Restore in pathname mode: host lists are backed up
+// file by file and would not match the restored serverclass.conf.
+var ErrRestorePathname = errors.New("restore is not supported in pathname mode")
+
+// Restore atomically replaces serverclass.conf with the content of a backup. The current
+// file is always backed up first (regardless of the backup setting), and automatic updates
+// are paused so the next cycle does not immediately overwrite the restore. It returns the
+// path of the backup taken of the current file, if any.
+func (u *Updater) Restore(b Backup) (string, error) {
+	if u.whitelistMode == ModePathname {
+		return "", ErrRestorePathname
+	}
+	data, err := u.ReadBackup(b)
+	if err != nil {
+		return "", err
+	}
+	var saved string
+	if _, err := u.fs.Stat(u.path); err == nil {
+		if saved, err = u.makeTimestampBackup(u.path); err != nil {
+			return "", fmt.Errorf("backup current file: %w", err)
+		}
+	}
+	// the current file is already saved; avoid a second backup in writeFile
+	backup := u.backup
+	u.backup = false
+	err = u.writeFile(u.path, data)
+	u.backup = backup
+	if err != nil {
+		return saved, err
+	}
+	return saved, u.Pause(PauseState{Reason: "rollback", RestoredFrom: b.Path})
+}
+
+// Pause stops automatic updates of this file until Resume is called.
+func (u *Updater) Pause(st PauseState) error {
+	if st.Since.IsZero() {
+		st.Since = time.Now().UTC()
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return afero.WriteFile(u.fs, u.pausePath(), append(b, '\n'), 0o644)
+}
+
+// Resume re-enables automatic updates. It is not an error if updates were not paused.
+func (u *Updater) Resume() error {
+	err := u.fs.Remove(u.pausePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Paused reports whether automatic updates are paused, and why.
+func (u *Updater) Paused() (*PauseState, error) {
+	b, err := afero.ReadFile(u.fs, u.pausePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var st PauseState
+	if err := json.Unmarshal(b, &st); err != nil {
+		// an unreadable marker still means paused
+		st.Reason = "unreadable pause file"
+	}
+	return &st, nil
+}
@@ -0,0 +1,114 @@
+package serverclass
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// ClassSpec describes a [serverClass:<name>] stanza owned by the updater and the
+// [serverClass:<name>:app:<app>] sub-stanzas it owns beneath it.
+type ClassSpec struct {
+	Settings map[string]string            // key -> value on the class stanza
+	Apps     map[string]map[string]string // app -> key -> value on the app sub-stanza
+}
+
+// Drift is a managed key whose value in serverclass.conf differs from the configured one.
+type Drift struct {
+	Stanza string `json:"stanza"`
+	Key    string `json:"key"`
+	Want   string `json:"want"`
+	Got    string `json:"got"`
+	// Missing is set when the key (or its whole stanza) was absent.
+	Missing bool `json:"missing,omitempty"`
+	// Unowned is set when the stanza lacks ManagedByMarker, so the drift was not corrected.
+	Unowned bool `json:"unowned,omitempty"`
+	// Fixed is set when the drift was corrected (not in dry-run, stanza owned).
+	Fixed bool `json:"fixed,omitempty"`
+}
+
+// EnsureStanzas creates missing stanzas (marked with ManagedByMarker) and sets the managed
+// keys of marked stanzas to the configured values. Keys that are not configured are left
+// alone; whitelist keys are handled by UpdateWhitelist. Existing stanzas without the marker
+// are hand-managed and only reported. Every difference is returned and logged as drift; in
+// dry-run (or for app stanzas of dry-run apps) nothing is written.
+func (u *Updater) EnsureStanzas(classes map[string]ClassSpec) ([]Drift, error) {
+	cfg, err := u.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	changed := false
+	apply := func(stanza string, settings map[string]string, dryRun bool) {
+		sec := cfg.Stanza(stanza)
+		if sec == nil {
+			drifts = append(drifts, Drift{Stanza: stanza, Missing: true})
+			if dryRun {
+				for _, key := range sortedKeys(settings) {
+					drifts = append(drifts, Drift{Stanza: stanza, Key: key, Want: settings[key], Missing: true})
+				}
+				return
+			}
+			sec = cfg.AddStanza(stanza)
+			sec.InsertComment(ManagedByMarker)
+			drifts[len(drifts)-1].Fixed = true
+			changed = true
+		}
+		// an existing stanza without the marker is hand-managed: report, never modify
+		owned := isOwned(sec)
+		for _, key := range sortedKeys(settings) {
+			want := settings[key]
+			got, ok := sec.Get(key)
+			if ok && got == want {
+				continue
+			}
+			d := Drift{Stanza: stanza, Key: key, Want: want, Got: got, Missing: !ok, Unowned: !owned}
+			if !dryRun && owned {
+				sec.Set(key, want)
+				d.Fixed = true
+				changed = true
+			}
+			drifts = append(drifts, d)
+		}
+	}
+
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec := classes[name]
+		classStanza := fmt.Sprintf("serverClass:%s", name)
+		apply(classStanza, spec.Settings, u.dryRun)
+		for _, app := range sortedKeys(spec.Apps) {
+			apply(fmt.Sprintf("%s:app:%s", classStanza, app), spec.Apps[app], u.dryRun || contains(u.dryRunApps, app))
+		}
+	}
+
+	for _, d := range drifts {
+		slog.Warn("serverclass stanza drift",
+			"stanza", d.Stanza,
+			"key", d.Key,
+			"want", d.Want,
+			"got", d.Got,
+			"missing", d.Missing,
+			"unowned", d.Unowned,
+			"file", u.path,
+		)
+	}
+	if !changed {
+		return drifts, nil
+	}
+	return drifts, u.write(cfg)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
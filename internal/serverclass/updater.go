@@ -1,26 +1,37 @@
 package serverclass
 
 import (
+	"crypto/sha256"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
-	"strings"
-	"time"
 
 	"github.com/spf13/afero"
-	"gopkg.in/ini.v1"
 )
 
 type Updater struct {
-	path       string
-	backup     bool
-	dryRun     bool
-	dryRunApps []string
-	fs         afero.Fs
+	path        string
+	backup      bool
+	dryRun      bool
+	dryRunApps  []string
+	managedBase int
+	// host list (whitelist.from_pathname) output
+	whitelistMode   string
+	pathnameClasses []string
+	hostListDir     string
+	hostListRefDir  string
+	backupDir       string
+	retention       Retention
+	reloadCommand   []string
+	lockOpts        LockOptions
+	// loaded fingerprints serverclass.conf as last read, to detect external edits before writing
+	loaded *fingerprint
+	// changes recorded for TakeChanges; backupsTaken are the backups of the update in progress
+	changes      []Change
+	backupsTaken []string
+	fs           afero.Fs
 	// App class names are the [serverClass:...] stanzas; whitelist is "whitelist"
 }
 type Config struct {
@@ -30,56 +41,99 @@ type Config struct {
 	AppDestination map[string]string // app -> dest key
 	DryRun         bool
 	DryRunApps     []string
+	// ManagedIndexBase is the first whitelist index the updater owns (default DefaultManagedIndexBase).
+	ManagedIndexBase int
+	// WhitelistMode is ModeInline (default) or ModePathname.
+	WhitelistMode string
+	// PathnameClasses limits pathname mode to these classes (default: all).
+	PathnameClasses []string
+	// HostListDir is where per-class host list files are written in pathname mode.
+	HostListDir string
+	// HostListRef is the directory written into whitelist.from_pathname (default HostListDir),
+	// e.g. a path relative to $SPLUNK_HOME.
+	HostListRef string
+	// BackupDir holds timestamped backups (default: next to each file).
+	BackupDir string
+	// Retention prunes and compresses backups after each new one.
+	Retention Retention
+	// ReloadCommand makes the deployment server re-read serverclass.conf (used by Reload).
+	ReloadCommand []string
+	// Lock controls the advisory lock taken by Lock.
+	Lock LockOptions
 }
 
 func NewUpdater(cfg Config) *Updater {
-	return &Updater{path: cfg.Path, backup: cfg.Backup, dryRun: cfg.DryRun, dryRunApps: cfg.DryRunApps, fs: afero.NewOsFs()}
+	base := cfg.ManagedIndexBase
+	if base <= 0 {
+		base = DefaultManagedIndexBase
+	}
+	return &Updater{
+		path:            cfg.Path,
+		backup:          cfg.Backup,
+		dryRun:          cfg.DryRun,
+		dryRunApps:      cfg.DryRunApps,
+		managedBase:     base,
+		whitelistMode:   cfg.WhitelistMode,
+		pathnameClasses: cfg.PathnameClasses,
+		hostListDir:     cfg.HostListDir,
+		hostListRefDir:  cfg.HostListRef,
+		backupDir:       cfg.BackupDir,
+		retention:       cfg.Retention,
+		reloadCommand:   cfg.ReloadCommand,
+		lockOpts:        cfg.Lock,
+		fs:              afero.NewOsFs(),
+	}
 }
 
 // SetFS allows overriding the filesystem (e.g., in tests) with an in-memory FS.
 func (u *Updater) SetFS(fs afero.Fs) { u.fs = fs }
 
 func (u *Updater) UpdateWhitelist(app string, serverClass string, patterns []string) error {
-	if err := u.fs.MkdirAll(filepath.Dir(u.path), 0o755); err != nil {
-		return err
+	u.backupsTaken = nil
+	if u.usePathname(serverClass) {
+		return u.updateHostList(app, serverClass, patterns)
 	}
-	var cfg *ini.File
-	var err error
-	if _, err = u.fs.Stat(u.path); err == nil {
-		b, rerr := afero.ReadFile(u.fs, u.path)
-		if rerr != nil {
-			return rerr
-		}
-		cfg, err = ini.Load(b)
-		if err != nil {
-			return fmt.Errorf("load serverclass: %w", err)
-		}
-	} else if os.IsNotExist(err) {
-		cfg = ini.Empty()
-	} else {
+	cfg, err := u.load()
+	if err != nil {
 		return err
 	}
 
 	secName := fmt.Sprintf("serverClass:%s", serverClass)
-	sec, _ := cfg.GetSection(secName)
+	sec := cfg.Stanza(secName)
 	if sec == nil {
-		sec, _ = cfg.NewSection(secName)
+		sec = cfg.AddStanza(secName)
+		sec.InsertComment(ManagedByMarker)
 	}
 
 	sort.Strings(patterns)
-	// Capture previous whitelist keys
-	prev := collectWhitelist(sec)
-	// Clear previous whitelist keys
+	// Capture previous managed whitelist keys; entries below the managed index range
+	// belong to humans and are left alone
+	prev := u.collectWhitelist(sec)
+	if unmanaged := u.unmanagedWhitelist(sec); len(unmanaged) > 0 {
+		slog.Warn("unmanaged whitelist entries in managed class",
+			"app", app,
+			"class", serverClass,
+			"keys", unmanaged,
+			"managedIndexBase", u.managedBase,
+			"file", u.path,
+		)
+	}
+	// Write as whitelist.<base+i> entries; existing keys are rewritten in place and
+	// surplus managed keys removed, leaving every other line untouched
+	want := make(map[string]bool, len(patterns))
+	for i := range patterns {
+		want[u.managedWhitelistKey(i)] = true
+	}
 	for _, k := range sec.Keys() {
-		if strings.HasPrefix(k.Name(), "whitelist") {
-			sec.DeleteKey(k.Name())
+		if u.isManagedWhitelistKey(k) && !want[k] {
+			sec.Delete(k)
 		}
 	}
-	// Write as whitelist.N entries (0-based)
 	for i, p := range patterns {
-		key := "whitelist." + strconv.Itoa(i)
-		sec.Key(key).SetValue(p)
+		sec.Set(u.managedWhitelistKey(i), p)
 	}
+	// a class moved back to inline mode no longer points at its host list
+	refDropped := u.dropOwnHostListRef(sec, serverClass)
 
 	// Compute diff
 	adds, removes := diffSets(prev, patterns)
@@ -92,72 +146,74 @@ func (u *Updater) UpdateWhitelist(app string, serverClass string, patterns []str
 			"-removes", len(removes),
 			"file", u.path,
 		)
+		u.recordChange(app, serverClass, adds, removes, true)
 		return nil
 	}
-	if len(adds) == 0 && len(removes) == 0 {
+	if len(adds) == 0 && len(removes) == 0 && !refDropped {
 		slog.Info("noop whitelist update", "app", app, "class", serverClass)
 		return nil
 	}
-	// Perform timestamped backup (copy) if enabled and target exists
-	if u.backup {
-		if _, statErr := u.fs.Stat(u.path); statErr == nil {
-			if _, err := u.makeTimestampBackup(); err != nil {
-				return err
-			}
-		}
-	}
-
-	// Write to a temp file then atomically replace
-	ts := time.Now().UTC().Format("20060102-150405")
-	tmpPath := fmt.Sprintf("%s.tmp-%d-%s", u.path, os.Getpid(), ts)
-	f, ferr := u.fs.Create(tmpPath)
-	if ferr != nil {
-		return ferr
-	}
-	_, werr := cfg.WriteTo(f)
-	cerr := f.Close()
-	if werr != nil {
-		_ = u.fs.Remove(tmpPath)
-		return werr
-	}
-	if cerr != nil {
-		_ = u.fs.Remove(tmpPath)
-		return cerr
-	}
-	if rerr := u.fs.Rename(tmpPath, u.path); rerr != nil {
-		// rollback: original file still intact (we only wrote temp). Cleanup temp and bubble error
-		_ = u.fs.Remove(tmpPath)
-		return rerr
+	if err := u.write(cfg); err != nil {
+		return err
 	}
+	u.recordChange(app, serverClass, adds, removes, false)
 	return nil
 }
 
-// makeTimestampBackup creates a copy of the current target file with a timestamped .bak suffix.
-func (u *Updater) makeTimestampBackup() (string, error) {
-	ts := time.Now().UTC().Format("20060102-150405")
-	backupPath := fmt.Sprintf("%s.%s.bak", u.path, ts)
-	src, err := u.fs.Open(u.path)
-	if err != nil {
-		return "", err
+// load reads the target file, or returns an empty file if it does not exist yet.
+func (u *Updater) load() (*ConfFile, error) {
+	if err := u.fs.MkdirAll(filepath.Dir(u.path), 0o755); err != nil {
+		return nil, err
 	}
-	defer src.Close()
-	dst, err := u.fs.Create(backupPath)
+	fp, b, err := u.fingerprint()
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("load serverclass: %w", err)
 	}
-	defer func() { _ = dst.Close() }()
-	if _, err := io.Copy(dst, src); err != nil {
-		_ = u.fs.Remove(backupPath)
-		return "", err
+	u.loaded = fp
+	return ParseConf(b), nil
+}
+
+// fingerprint identifies a version of serverclass.conf.
+type fingerprint struct {
+	exists bool
+	sum    [sha256.Size]byte
+}
+
+func (u *Updater) fingerprint() (*fingerprint, []byte, error) {
+	b, err := afero.ReadFile(u.fs, u.path)
+	if os.IsNotExist(err) {
+		return &fingerprint{}, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return &fingerprint{exists: true, sum: sha256.Sum256(b)}, b, nil
+}
+
+// write backs up the current serverclass.conf (if enabled) and atomically replaces it with
+// cfg. It aborts if the file changed since load, so concurrent edits are never lost.
+func (u *Updater) write(cfg *ConfFile) error {
+	if u.loaded != nil {
+		cur, _, err := u.fingerprint()
+		if err != nil {
+			return err
+		}
+		if *cur != *u.loaded {
+			return fmt.Errorf("%s: %w", u.path, ErrModifiedExternally)
+		}
+	}
+	if err := u.writeFile(u.path, cfg.Bytes()); err != nil {
+		return err
 	}
-	return backupPath, nil
+	u.loaded = nil
+	return nil
 }
 
-func collectWhitelist(sec *ini.Section) []string {
+func (u *Updater) collectWhitelist(sec *ConfStanza) []string {
 	var vals []string
 	for _, k := range sec.Keys() {
-		if strings.HasPrefix(k.Name(), "whitelist") {
-			vals = append(vals, k.Value())
+		if u.isManagedWhitelistKey(k) {
+			v, _ := sec.Get(k)
+			vals = append(vals, v)
 		}
 	}
 	sort.Strings(vals)
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/audit"
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+func TestAuditLog_RecordsWhitelistChanges(t *testing.T) {
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/ds/serverclass.conf",
+			Backup:         true,
+			AppClass:       map[string]string{"app1": "class1"},
+			AppDestination: map[string]string{"app1": "dest1"},
+		},
+		Audit: config.AuditConfig{File: "/var/log/camr-audit.jsonl"},
+	}
+	c := &recordCMDB{records: map[string]cmdb.Entry{
+		"s1": {ID: "s1", Hostname: "web01", BusinessServiceLane: "lane1"},
+		"s2": {ID: "s2", Hostname: "db01", BusinessServiceLane: "lane1"},
+	}}
+	r, err := runner.New(cfg, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+	r.AuditLog().SetFS(mem)
+	ctx := context.Background()
+
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	delete(c.records, "s2")
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// nothing changes: no record
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := afero.ReadFile(mem, "/var/log/camr-audit.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit records, got %d:\n%s", len(lines), b)
+	}
+	var first, second audit.Record
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.Class != "class1" || strings.Join(first.Added, ",") != "db01,web01" || first.DryRun || first.ConfigHash == "" || first.Snapshot == "" {
+		t.Fatalf("unexpected first record %+v", first)
+	}
+	if strings.Join(second.Removed, ",") != "db01" || strings.Join(second.RemovedHosts["db01"], ",") != "db01" ||
+		strings.Join(second.HostsLeft, ",") != "db01" || len(second.Backups) != 1 || second.Snapshot == first.Snapshot {
+		t.Fatalf("unexpected second record %+v", second)
+	}
+}
+
+func TestAuditLog_DryRunProposalRecordedOnce(t *testing.T) {
+	cfg := &config.Config{
+		DryRun:       true,
+		Destinations: map[string][]string{"dest1": {"lane1"}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/ds/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1"},
+			AppDestination: map[string]string{"app1": "dest1"},
+		},
+		Audit: config.AuditConfig{File: "/var/log/camr-audit.jsonl"},
+	}
+	c := &recordCMDB{records: map[string]cmdb.Entry{
+		"s1": {ID: "s1", Hostname: "web01", BusinessServiceLane: "lane1"},
+	}}
+	r, err := runner.New(cfg, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+	r.AuditLog().SetFS(mem)
+	ctx := context.Background()
+
+	// the same proposal every cycle is recorded once; a different one again
+	for i := 0; i < 3; i++ {
+		if err := r.RunOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.records["s2"] = cmdb.Entry{ID: "s2", Hostname: "db01", BusinessServiceLane: "lane1"}
+	for i := 0; i < 2; i++ {
+		if err := r.RunOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := afero.ReadFile(mem, "/var/log/camr-audit.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit records, got %d:\n%s", len(lines), b)
+	}
+	var second audit.Record
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if !second.DryRun || strings.Join(second.Added, ",") != "db01,web01" {
+		t.Fatalf("unexpected second record %+v", second)
+	}
+}
@@ -0,0 +1,46 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example/splunk-ds-camr/internal/config"
+)
+
+func TestLoad_RejectsTargetsSharingBackupOrHostListDirs(t *testing.T) {
+	cases := map[string]struct {
+		targets string
+		err     string // empty: valid
+	}{
+		"own backupDirs": {targets: `
+    - {path: /ds1/serverclass.conf, backupDir: /bak/ds1}
+    - {path: /ds2/serverclass.conf, backupDir: /bak/ds2}`},
+		"shared backupDir": {targets: `
+    - {path: /ds1/serverclass.conf, backupDir: /bak}
+    - {path: /ds2/serverclass.conf, backupDir: /bak}`, err: "share backupDir /bak"},
+		"backupDir next to another target's file": {targets: `
+    - {path: /ds1/serverclass.conf}
+    - {path: /ds2/serverclass.conf, backupDir: /ds1}`, err: "would both back up to /ds1/serverclass.conf"},
+		"shared hostListDir": {targets: `
+    - {path: /ds1/serverclass.conf, whitelistMode: pathname, hostListDir: /lists}
+    - {path: /ds2/serverclass.conf, whitelistMode: pathname, hostListDir: /lists/}`, err: "share hostListDir /lists"},
+		"backupDir is another target's hostListDir": {targets: `
+    - {path: /ds1/serverclass.conf, whitelistMode: pathname, hostListDir: /lists}
+    - {path: /ds2/serverclass.conf, backupDir: /lists}`, err: "share backupDir /lists"},
+	}
+	for name, c := range cases {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("serverclass:\n  targets:"+c.targets+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := config.Load(path)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", name, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: expected error containing %q, got %v", name, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+func TestExplain(t *testing.T) {
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}, "dest2": {"lane2"}},
+		CMDB: config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: []config.DummyCMDBEntry{
+			{Hostname: "abc001", BusinessServiceLane: "lane1"},
+			{Hostname: "abc002", BusinessServiceLane: "lane1"},
+			{Hostname: "xyz001", BusinessServiceLane: "lane9"},
+		}}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1", "app2": "class2"},
+			AppDestination: map[string]string{"app1": "dest1", "app2": "dest2"},
+		},
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	// a hand-made class that also catches abc001
+	if err := afero.WriteFile(mem, "/serverclass.conf", []byte("[serverClass:legacy]\nwhitelist.0 = abc*\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+	ctx := context.Background()
+
+	// before the first sync: routed to dest1, covered by abc*, not yet in class1
+	ex, err := r.Explain(ctx, "ABC001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ex.Records) != 1 || len(ex.Destinations) != 1 || ex.Destinations[0].Name != "dest1" {
+		t.Fatalf("unexpected routing explanation %+v", ex)
+	}
+	classes := map[string]runner.ClassExplanation{}
+	for _, c := range ex.Targets[0].Classes {
+		classes[c.Class] = c
+	}
+	if c := classes["class1"]; !c.Expected || c.Included() || len(c.Patterns) != 1 || c.Patterns[0] != "abc*" {
+		t.Fatalf("class1 should be expected but not yet included: %+v", c)
+	}
+	if c := classes["legacy"]; c.Expected || !c.Included() || c.Whitelisted[0].Managed {
+		t.Fatalf("legacy should include the host by a hand-managed entry: %+v", c)
+	}
+	if c := classes["class2"]; c.Expected || c.Included() {
+		t.Fatalf("class2 should neither expect nor include the host: %+v", c)
+	}
+
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ex, _ = r.Explain(ctx, "abc001")
+	for _, c := range ex.Targets[0].Classes {
+		if c.Class == "class1" && (!c.Included() || !c.Whitelisted[0].Managed) {
+			t.Fatalf("class1 should include the host after a sync: %+v", c)
+		}
+	}
+
+	// unrouted host
+	ex, _ = r.Explain(ctx, "xyz001")
+	if len(ex.Records) != 1 || len(ex.Records[0].Route.Destinations) != 0 || len(ex.Destinations) != 0 {
+		t.Fatalf("unexpected explanation for an unrouted host %+v", ex)
+	}
+}
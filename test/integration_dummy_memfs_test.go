@@ -90,9 +90,9 @@ func TestIntegration_DummyMemFS(t *testing.T) {
 	content := string(b)
 	if !containsAll(content, []string{
 		"[serverClass:AA-DESTINATION-dest1-class]",
-		"whitelist.0 = abc*",
+		"whitelist.1000 = abc*",
 		"[serverClass:AA-DESTINATION-dest2-class]",
-		"whitelist.0 = xyz*",
+		"whitelist.1000 = xyz*",
 	}) {
 		t.Fatalf("unexpected serverclass.conf contents:\n%s", content)
 	}
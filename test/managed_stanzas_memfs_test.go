@@ -0,0 +1,79 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+func TestEnsureStanzas_CreatesAndReportsDrift(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	seed := "[serverClass:dest1-class]\n" + serverclass.ManagedByMarker + "\nrestartSplunkd = false\nwhitelist.1000 = abc*\n\n[serverClass:hand-made]\nstateOnClient = noop\n"
+	if err := afero.WriteFile(mem, "/serverclass.conf", []byte(seed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u := serverclass.NewUpdater(serverclass.Config{Path: "/serverclass.conf"})
+	u.SetFS(mem)
+
+	classes := map[string]serverclass.ClassSpec{
+		"dest1-class": {
+			Settings: map[string]string{"restartSplunkd": "true", "stateOnClient": "enabled"},
+			Apps: map[string]map[string]string{
+				"AA-DESTINATION-dest1": {"restartSplunkd": "true"},
+			},
+		},
+		// exists without the ownership marker: reported, never modified
+		"hand-made": {Settings: map[string]string{"stateOnClient": "enabled"}},
+	}
+	drifts, err := u.EnsureStanzas(classes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changed, missing, missingStanza, unowned bool
+	for _, d := range drifts {
+		switch {
+		case d.Stanza == "serverClass:hand-made" && d.Key == "stateOnClient" && d.Got == "noop" && d.Unowned:
+			unowned = true
+		case d.Stanza == "serverClass:dest1-class" && d.Key == "restartSplunkd" && d.Got == "false":
+			changed = true
+		case d.Stanza == "serverClass:dest1-class" && d.Key == "stateOnClient" && d.Missing:
+			missing = true
+		case d.Stanza == "serverClass:dest1-class:app:AA-DESTINATION-dest1" && d.Key == "" && d.Missing:
+			missingStanza = true
+		}
+	}
+	if !changed || !missing || !missingStanza || !unowned {
+		t.Fatalf("unexpected drift report: %+v", drifts)
+	}
+
+	b, err := afero.ReadFile(mem, "/serverclass.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(b)
+	// compare with whitespace collapsed so key alignment does not matter
+	if !containsAll(strings.Join(strings.Fields(content), " "), []string{
+		"restartSplunkd = true",
+		"stateOnClient = enabled",
+		"whitelist.1000 = abc*",
+		"[serverClass:dest1-class:app:AA-DESTINATION-dest1] " + serverclass.ManagedByMarker,
+		"[serverClass:hand-made] stateOnClient = noop",
+	}) {
+		t.Fatalf("unexpected serverclass.conf contents:\n%s", content)
+	}
+
+	// second pass only reports the hand-managed stanza
+	drifts, err = u.EnsureStanzas(classes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 || !drifts[0].Unowned {
+		t.Fatalf("expected only unowned drift after enforcement, got %+v", drifts)
+	}
+	if strings.Count(content, "[serverClass:dest1-class]") != 1 {
+		t.Fatalf("class stanza duplicated:\n%s", content)
+	}
+}
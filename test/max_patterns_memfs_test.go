@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+func TestMaxPatternsBudget(t *testing.T) {
+	var entries []config.DummyCMDBEntry
+	for _, h := range []string{"web01", "web02", "web03", "wex01", "wex02", "wey01"} {
+		entries = append(entries, config.DummyCMDBEntry{Hostname: h, BusinessServiceLane: "lane1"})
+	}
+	entries = append(entries, config.DummyCMDBEntry{Hostname: "wez01", BusinessServiceLane: "lane2"})
+	two := 2
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}, "dest2": {"lane2"}},
+		CMDB:         config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: entries}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1", "app2": "class2", "app3": "class3"},
+			AppDestination: map[string]string{"app1": "dest1", "app2": "dest1", "app3": "dest1"},
+		},
+		Wildcard: config.WildcardConfig{
+			Mode:         "trailingOnly",
+			MinGroupSize: 2,
+			MaxPatterns:  4,
+			Classes: map[string]config.WildcardOptions{
+				"class2": {Mode: "exact"},
+				"class3": {MaxPatterns: &two},
+			},
+		},
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/serverclass.conf", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+	if err := r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"class1": "web*,wex*,wey01",                     // the mode's output fits the budget of 4
+		"class2": "web01,web02,web03,wex01,wex02,wey01", // exact mode is never generalized
+		"class3": "web*,wex*,wey01",                     // "we*" would match wez01 of dest2: kept as is
+	}
+	for class, w := range want {
+		got, err := tg.Updater.Whitelist(class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != w {
+			t.Errorf("%s whitelist = %v, want %s", class, got, w)
+		}
+	}
+
+	// without the conflicting host, class3 is generalized to fit
+	cfg.CMDB.Dummy.Entries = entries[:6]
+	r, err = runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg, _ = r.Target("")
+	tg.Updater.SetFS(mem)
+	if err := r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := tg.Updater.Whitelist("class3"); strings.Join(got, ",") != "we*" {
+		t.Errorf("class3 whitelist = %v, want [we*]", got)
+	}
+}
+
+func TestMaxPatternsBudget_Tokenized(t *testing.T) {
+	var entries []config.DummyCMDBEntry
+	for _, h := range []string{"lon-prd-web01", "lon-prd-web02", "lon-prd-wex01", "lon-prd-wex02", "lon-prd-db01", "lon-dev-web01", "lon-dev-web02"} {
+		entries = append(entries, config.DummyCMDBEntry{Hostname: h, BusinessServiceLane: "lane1"})
+	}
+	entries = append(entries, config.DummyCMDBEntry{Hostname: "lon-uat-app01", BusinessServiceLane: "lane2"})
+	two, whole := 2, true
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}, "dest2": {"lane2"}},
+		CMDB:         config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: entries}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1", "app2": "class2"},
+			AppDestination: map[string]string{"app1": "dest1", "app2": "dest1"},
+		},
+		Wildcard: config.WildcardConfig{
+			Mode:         "tokenized",
+			MinGroupSize: 2,
+			MaxPatterns:  2,
+			Classes: map[string]config.WildcardOptions{
+				"class2": {WholeTokens: &whole, MaxPatterns: &two},
+			},
+		},
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/serverclass.conf", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+	if err := r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		// over budget, but no token is cut and the mode's patterns are kept, not exploded into hosts
+		"class1": "lon-dev-web*,lon-prd-db01,lon-prd-web*,lon-prd-wex*",
+		// whole tokens may go: a trailing token, one position, without reaching lon-uat-app01
+		"class2": "lon-dev-web*,lon-prd-*",
+	}
+	for class, w := range want {
+		got, err := tg.Updater.Whitelist(class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != w {
+			t.Errorf("%s whitelist = %v, want %s", class, got, w)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+type countingCMDB struct {
+	cmdb.Client
+	calls int
+}
+
+func (c *countingCMDB) Fetch(ctx context.Context) ([]cmdb.Entry, error) {
+	c.calls++
+	return c.Client.Fetch(ctx)
+}
+
+func TestMultipleTargets_SingleFetch(t *testing.T) {
+	cfg := &config.Config{
+		Destinations: map[string][]string{
+			"east":    {"lane1"},
+			"central": {"lane1", "lane3"},
+		},
+		CMDB: config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: []config.DummyCMDBEntry{
+			{Hostname: "abc001", BusinessServiceLane: "lane1"},
+			{Hostname: "abc002", BusinessServiceLane: "lane1"},
+			{Hostname: "xyz101", BusinessServiceLane: "lane3"},
+		}}},
+		Serverclass: config.ServerclassConfig{Targets: []config.ServerclassTarget{
+			{
+				Name:           "ds-east",
+				Path:           "/east/serverclass.conf",
+				AppClass:       map[string]string{"AA-DESTINATION-east": "east-class"},
+				AppDestination: map[string]string{"AA-DESTINATION-east": "east"},
+			},
+			{
+				Name:           "ds-central",
+				Path:           "/central/apps/ds/local/serverclass.conf",
+				AppClass:       map[string]string{"AA-DESTINATION-central": "central-class"},
+				AppDestination: map[string]string{"AA-DESTINATION-central": "central"},
+			},
+		}},
+	}
+
+	fs := afero.NewMemMapFs()
+	c := &countingCMDB{Client: cmdb.NewDummy(cfg.CMDB.Dummy)}
+	r, err := runner.New(cfg, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tg := range r.Targets() {
+		tg.Updater.SetFS(fs)
+	}
+	if err := r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.calls != 1 {
+		t.Fatalf("expected a single CMDB fetch, got %d", c.calls)
+	}
+
+	east, err := afero.ReadFile(fs, "/east/serverclass.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsAll(string(east), []string{"[serverClass:east-class]", "whitelist.1000 = abc*"}) ||
+		strings.Contains(string(east), "central-class") {
+		t.Fatalf("unexpected east serverclass.conf:\n%s", east)
+	}
+	central, err := afero.ReadFile(fs, "/central/apps/ds/local/serverclass.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsAll(string(central), []string{"[serverClass:central-class]", "whitelist.1000 = abc*", "whitelist.1001 = xyz101"}) {
+		t.Fatalf("unexpected central serverclass.conf:\n%s", central)
+	}
+}
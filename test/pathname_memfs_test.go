@@ -0,0 +1,168 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+func TestPathnameMode_WritesHostListAndReference(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	seed := "[serverClass:big-class]\n" + serverclass.ManagedByMarker + "\nwhitelist.0 = hand01\nwhitelist.1000 = abc*\n"
+	if err := afero.WriteFile(mem, "/ds/serverclass.conf", []byte(seed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := serverclass.Config{
+		Path:          "/ds/serverclass.conf",
+		Backup:        true,
+		WhitelistMode: serverclass.ModePathname,
+		HostListDir:   "/ds/hostlists",
+		HostListRef:   "etc/system/local/hostlists",
+	}
+
+	// dry-run writes nothing
+	dry := cfg
+	dry.DryRun = true
+	u := serverclass.NewUpdater(dry)
+	u.SetFS(mem)
+	if err := u.UpdateWhitelist("app", "big-class", []string{"xyz*", "abc*"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := afero.Exists(mem, "/ds/hostlists/big-class.txt"); ok {
+		t.Fatal("dry-run wrote the host list")
+	}
+
+	u = serverclass.NewUpdater(cfg)
+	u.SetFS(mem)
+	if err := u.UpdateWhitelist("app", "big-class", []string{"xyz*", "abc*"}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := afero.ReadFile(mem, "/ds/hostlists/big-class.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(list) != "abc*\nxyz*\n" {
+		t.Fatalf("unexpected host list: %q", list)
+	}
+	conf, err := afero.ReadFile(mem, "/ds/serverclass.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(conf)
+	if !strings.Contains(content, "whitelist.from_pathname = etc/system/local/hostlists/big-class.txt") ||
+		!strings.Contains(content, "whitelist.0 = hand01") ||
+		strings.Contains(content, "whitelist.1000") {
+		t.Fatalf("unexpected serverclass.conf:\n%s", content)
+	}
+
+	// a list change is written atomically and backed up; the conf is left alone
+	if err := u.UpdateWhitelist("app", "big-class", []string{"abc*"}); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = afero.ReadFile(mem, "/ds/hostlists/big-class.txt")
+	if string(list) != "abc*\n" {
+		t.Fatalf("unexpected host list after update: %q", list)
+	}
+	entries, _ := afero.ReadDir(mem, "/ds/hostlists")
+	var bak bool
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "big-class.txt.") && strings.HasSuffix(e.Name(), ".bak") {
+			bak = true
+		}
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Fatalf("temp file left behind: %s", e.Name())
+		}
+	}
+	if !bak {
+		t.Fatal("expected a host list backup")
+	}
+
+	// a serverclass.conf backup alone cannot bring the host lists back: refused
+	backups, err := u.ListBackups(u.Path())
+	if err != nil || len(backups) == 0 {
+		t.Fatalf("expected a serverclass.conf backup: %v %v", backups, err)
+	}
+	if _, err := u.Restore(backups[0]); !errors.Is(err, serverclass.ErrRestorePathname) {
+		t.Fatalf("expected ErrRestorePathname, got %v", err)
+	}
+	if after, _ := afero.ReadFile(mem, "/ds/serverclass.conf"); string(after) != content {
+		t.Fatalf("serverclass.conf changed by a refused restore:\n%s", after)
+	}
+}
+
+// failConfRenameFs fails replacing one file, e.g. serverclass.conf.
+type failConfRenameFs struct {
+	afero.Fs
+	path string
+}
+
+func (f failConfRenameFs) Rename(oldname, newname string) error {
+	if newname == f.path {
+		return errors.New("simulated rename failure")
+	}
+	return f.Fs.Rename(oldname, newname)
+}
+
+func TestPathnameMode_ConfWriteFailureRestoresHostList(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/ds/serverclass.conf", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := serverclass.Config{Path: "/ds/serverclass.conf", WhitelistMode: serverclass.ModePathname, HostListDir: "/ds/hostlists"}
+	failing := failConfRenameFs{Fs: mem, path: "/ds/serverclass.conf"}
+
+	// new list: removed again
+	u := serverclass.NewUpdater(cfg)
+	u.SetFS(failing)
+	if err := u.UpdateWhitelist("app", "c", []string{"abc*"}); err == nil {
+		t.Fatal("expected the serverclass.conf write to fail")
+	}
+	if ok, _ := afero.Exists(mem, "/ds/hostlists/c.txt"); ok {
+		t.Fatal("host list left behind without a reference")
+	}
+
+	u = serverclass.NewUpdater(cfg)
+	u.SetFS(mem)
+	if err := u.UpdateWhitelist("app", "c", []string{"abc*"}); err != nil {
+		t.Fatal(err)
+	}
+	// existing list: the reference changes, so the conf is rewritten and fails
+	cfg.HostListRef = "etc/hostlists"
+	u = serverclass.NewUpdater(cfg)
+	u.SetFS(failing)
+	if err := u.UpdateWhitelist("app", "c", []string{"abc*", "xyz*"}); err == nil {
+		t.Fatal("expected the serverclass.conf write to fail")
+	}
+	if list, _ := afero.ReadFile(mem, "/ds/hostlists/c.txt"); string(list) != "abc*\n" {
+		t.Fatalf("host list not restored: %q", list)
+	}
+}
+
+func TestPathnameMode_SanitizedClassNamesDoNotCollide(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/ds/serverclass.conf", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u := serverclass.NewUpdater(serverclass.Config{Path: "/ds/serverclass.conf", WhitelistMode: serverclass.ModePathname, HostListDir: "/ds/hostlists"})
+	u.SetFS(mem)
+	if err := u.UpdateWhitelist("app1", "a/b", []string{"abc*"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.UpdateWhitelist("app2", "a_b", []string{"xyz*"}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := afero.ReadDir(mem, "/ds/hostlists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected one host list per class, got %d", len(files))
+	}
+	if list, _ := afero.ReadFile(mem, "/ds/hostlists/a_b.txt"); string(list) != "xyz*\n" {
+		t.Fatalf("unexpected a_b host list: %q", list)
+	}
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/dsclients"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+func TestPlanPreview(t *testing.T) {
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}, "dest2": {"lane2"}},
+		CMDB: config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: []config.DummyCMDBEntry{
+			{Hostname: "abc001", BusinessServiceLane: "lane1"},
+			{Hostname: "abc002", BusinessServiceLane: "lane1"},
+			{Hostname: "abc100", BusinessServiceLane: "lane2"},
+			{Hostname: "abc900", BusinessServiceLane: "lane9"},
+		}}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1"},
+			AppDestination: map[string]string{"app1": "dest1"},
+		},
+		Wildcard: config.WildcardConfig{Mode: "trailingOnly", MinGroupSize: 2},
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	// a previously published pattern the next cycle drops
+	conf := "[serverClass:class1]\nwhitelist.1000 = old01\n\n[serverClass:class1:app:app1]\n"
+	if err := afero.WriteFile(mem, "/serverclass.conf", []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+
+	clients := []dsclients.Client{{Hostname: "abc001"}, {Hostname: "abc555", DNS: "abc555.example.com"}}
+	plan, err := r.Plan(context.Background(), clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Clients != 1 || len(plan.Targets) != 1 || len(plan.Targets[0].Classes) != 1 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	c := plan.Targets[0].Classes[0]
+	if add, keep, remove := c.Counts(); add != 1 || keep != 0 || remove != 1 {
+		t.Fatalf("counts = %d/%d/%d, patterns %+v", add, keep, remove, c.Patterns)
+	}
+	p := c.Patterns[0]
+	if p.Pattern != "abc*" || p.Change != runner.ChangeAdd || p.Matches != 5 {
+		t.Fatalf("unexpected preview %+v", p)
+	}
+	if len(p.Foreign) != 1 || p.Foreign[0].Host != "abc100" || p.Foreign[0].Destinations[0] != "dest2" {
+		t.Fatalf("foreign = %+v", p.Foreign)
+	}
+	if len(p.Unknown) != 2 || p.Unknown[0] != "abc555" || p.Unknown[1] != "abc900" || p.Safe() {
+		t.Fatalf("unknown = %v", p.Unknown)
+	}
+	if rm := c.Patterns[1]; rm.Pattern != "old01" || rm.Change != runner.ChangeRemove || rm.Matches != 0 {
+		t.Fatalf("unexpected removal %+v", rm)
+	}
+	// nothing written
+	if b, _ := afero.ReadFile(mem, "/serverclass.conf"); string(b) != conf {
+		t.Fatalf("plan wrote the file:\n%s", b)
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+	"github.com/example/splunk-ds-camr/internal/serverclass"
+)
+
+func TestRestoreBackup_PausesUntilResumed(t *testing.T) {
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}},
+		CMDB: config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: []config.DummyCMDBEntry{
+			{Hostname: "abc001", BusinessServiceLane: "lane1"},
+			{Hostname: "abc002", BusinessServiceLane: "lane1"},
+		}}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/serverclass.conf",
+			Backup:         true,
+			AppClass:       map[string]string{"AA-DESTINATION-dest1": "dest1-class"},
+			AppDestination: map[string]string{"AA-DESTINATION-dest1": "dest1"},
+		},
+	}
+	mem := afero.NewMemMapFs()
+	original := "[serverClass:dest1-class]\nwhitelist.1000 = oldvalue\n"
+	if err := afero.WriteFile(mem, "/serverclass.conf", []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg, err := r.Target("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := tg.Updater
+	u.SetFS(mem)
+
+	ctx := context.Background()
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := u.ListBackups(u.Path())
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v %v", backups, err)
+	}
+	cur, _ := u.Current()
+	old, _ := u.ReadBackup(backups[0])
+	diff, st := serverclass.UnifiedDiff(u.Path(), backups[0].Path, cur, old)
+	if st.Added != 1 || st.Removed != 1 || !strings.Contains(diff, "-whitelist.1000 = abc*") || !strings.Contains(diff, "+whitelist.1000 = oldvalue") {
+		t.Fatalf("unexpected diff %+v:\n%s", st, diff)
+	}
+
+	saved, err := u.Restore(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved == "" {
+		t.Fatal("current file was not backed up before restoring")
+	}
+	if b, _ := u.Current(); string(b) != original {
+		t.Fatalf("restore did not bring back the original:\n%s", b)
+	}
+
+	// paused: the next cycle leaves the restored file alone
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := u.Current(); string(b) != original {
+		t.Fatalf("paused target was updated:\n%s", b)
+	}
+
+	if err := u.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := u.Current(); !strings.Contains(string(b), "whitelist.1000 = abc*") {
+		t.Fatalf("resumed target was not updated:\n%s", b)
+	}
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+// recordCMDB serves a mutable set of records by ID and counts full fetches.
+type recordCMDB struct {
+	records     map[string]cmdb.Entry
+	fullFetches int
+	byID        []string
+}
+
+func (c *recordCMDB) Fetch(ctx context.Context) ([]cmdb.Entry, error) {
+	c.fullFetches++
+	var out []cmdb.Entry
+	for _, e := range c.records {
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (c *recordCMDB) FetchByID(ctx context.Context, id string) ([]cmdb.Entry, error) {
+	c.byID = append(c.byID, id)
+	if e, ok := c.records[id]; ok {
+		return []cmdb.Entry{e}, nil
+	}
+	return nil, nil
+}
+
+func TestNotifyChanged_TargetedResync(t *testing.T) {
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1"},
+			AppDestination: map[string]string{"app1": "dest1"},
+		},
+	}
+	c := &recordCMDB{records: map[string]cmdb.Entry{
+		"s1": {ID: "s1", Hostname: "abc001", BusinessServiceLane: "lane1"},
+		"s2": {ID: "s2", Hostname: "abc002", BusinessServiceLane: "lane1"},
+	}}
+	r, err := runner.New(cfg, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+	ctx := context.Background()
+
+	// before any full fetch there is no snapshot to patch: full cycle
+	r.NotifyChanged("test", "s1")
+	<-r.Triggers()
+	if err := r.RunTriggered(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.fullFetches != 1 || len(c.byID) != 0 {
+		t.Fatalf("expected a full fetch, got %d full / %v targeted", c.fullFetches, c.byID)
+	}
+
+	// s2 moves away and a new host appears: only those records are fetched
+	c.records["s2"] = cmdb.Entry{ID: "s2", Hostname: "abc002", BusinessServiceLane: "other"}
+	c.records["s3"] = cmdb.Entry{ID: "s3", Hostname: "xyz001", BusinessServiceLane: "lane1"}
+	r.NotifyChanged("test", "s2")
+	if r.NotifyChanged("test", "s3") {
+		t.Fatal("second notification was not coalesced")
+	}
+	<-r.Triggers()
+	if err := r.RunTriggered(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.fullFetches != 1 || strings.Join(c.byID, ",") != "s2,s3" {
+		t.Fatalf("expected a targeted resync of s2,s3, got %d full / %v targeted", c.fullFetches, c.byID)
+	}
+	b, _ := afero.ReadFile(mem, "/serverclass.conf")
+	got := string(b)
+	if !strings.Contains(got, "abc001") || strings.Contains(got, "abc*") || !strings.Contains(got, "xyz001") {
+		t.Fatalf("targeted resync not applied:\n%s", got)
+	}
+	if h := r.History(1); len(h) != 1 || strings.Join(h[0].Targeted, ",") != "s2,s3" {
+		t.Fatalf("run not recorded as targeted: %+v", h)
+	}
+
+	// an explicit trigger always fetches everything
+	r.Trigger("test")
+	<-r.Triggers()
+	if err := r.RunTriggered(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.fullFetches != 2 {
+		t.Fatalf("expected a full fetch after Trigger, got %d", c.fullFetches)
+	}
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+func TestVerify(t *testing.T) {
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}, "dest2": {"lane2"}},
+		CMDB: config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: []config.DummyCMDBEntry{
+			{Hostname: "abc001", BusinessServiceLane: "lane1"},
+			{Hostname: "abc002", BusinessServiceLane: "lane1"},
+			{Hostname: "def001", BusinessServiceLane: "lane2"},
+			{Hostname: "xyz001", BusinessServiceLane: "lane9"},
+		}}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1", "app2": "class2"},
+			AppDestination: map[string]string{"app1": "dest1", "app2": "dest2"},
+		},
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/serverclass.conf", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+	ctx := context.Background()
+
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	v, err := r.Verify(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the unrouted host is in no class after a sync
+	if len(v.Violations) != 1 || v.Violations[0].Kind != runner.ViolationNoClass || v.Violations[0].Host != "xyz001" {
+		t.Fatalf("unexpected violations after a sync: %+v", v.Violations)
+	}
+
+	// hand edits: class2 also catches ABC002, blacklists abc001 from class1, and a stale entry
+	b, _ := afero.ReadFile(mem, "/serverclass.conf")
+	b = append(b, []byte("\n[serverClass:class2]\nwhitelist.0 = ABC002\nwhitelist.1 = old*.example.com\n\n[serverClass:class1]\nblacklist.0 = abc001\n")...)
+	if err := afero.WriteFile(mem, "/serverclass.conf", b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err = r.Verify(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string][]string{}
+	for _, vi := range v.Violations {
+		kinds[vi.Kind] = append(kinds[vi.Kind], vi.Host+vi.Pattern)
+	}
+	want := map[string][]string{
+		runner.ViolationNoClass:              {"abc001", "xyz001"},
+		runner.ViolationWrongClass:           {"abc002"},
+		runner.ViolationMultipleDestinations: {"abc002"},
+		runner.ViolationUnusedPattern:        {"old*.example.com"},
+	}
+	for k, hosts := range want {
+		if len(kinds[k]) != len(hosts) {
+			t.Fatalf("%s: got %v, want %v (all: %+v)", k, kinds[k], hosts, v.Violations)
+		}
+		for i := range hosts {
+			if kinds[k][i] != hosts[i] {
+				t.Fatalf("%s: got %v, want %v", k, kinds[k], hosts)
+			}
+		}
+	}
+	if len(kinds) != len(want) || v.OK() {
+		t.Fatalf("unexpected violation kinds %v", kinds)
+	}
+}
+
+func TestVerify_MultipleTargets(t *testing.T) {
+	cfg := &config.Config{
+		Destinations: map[string][]string{"east": {"lane1"}, "central": {"lane3"}},
+		CMDB: config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: []config.DummyCMDBEntry{
+			{Hostname: "abc001", BusinessServiceLane: "lane1"},
+			{Hostname: "abc002", BusinessServiceLane: "lane1"},
+			{Hostname: "xyz101", BusinessServiceLane: "lane3"},
+		}}},
+		Serverclass: config.ServerclassConfig{Targets: []config.ServerclassTarget{
+			{
+				Name:           "ds-east",
+				Path:           "/east/serverclass.conf",
+				AppClass:       map[string]string{"AA-DESTINATION-east": "east-class"},
+				AppDestination: map[string]string{"AA-DESTINATION-east": "east"},
+			},
+			{
+				Name:           "ds-central",
+				Path:           "/central/serverclass.conf",
+				AppClass:       map[string]string{"AA-DESTINATION-central": "central-class"},
+				AppDestination: map[string]string{"AA-DESTINATION-central": "central"},
+			},
+		}},
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	for _, tg := range r.Targets() {
+		tg.Updater.SetFS(mem)
+	}
+	ctx := context.Background()
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// each host is only the concern of the target managing its destination
+	for _, name := range []string{"", "ds-east", "ds-central"} {
+		v, err := r.Verify(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !v.OK() {
+			t.Fatalf("verify %q: unexpected violations after a sync: %+v", name, v.Violations)
+		}
+	}
+
+	// central loses its class: only ds-central reports xyz101
+	if err := afero.WriteFile(mem, "/central/serverclass.conf", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := r.Verify(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Violations) != 1 || v.Violations[0].Kind != runner.ViolationNoClass ||
+		v.Violations[0].Target != "ds-central" || v.Violations[0].Host != "xyz101" {
+		t.Fatalf("unexpected violations: %+v", v.Violations)
+	}
+	if v, err = r.Verify(ctx, "ds-east"); err != nil || !v.OK() {
+		t.Fatalf("verify ds-east: %v %+v", err, v.Violations)
+	}
+}
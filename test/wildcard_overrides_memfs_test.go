@@ -0,0 +1,85 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/example/splunk-ds-camr/internal/cmdb"
+	"github.com/example/splunk-ds-camr/internal/config"
+	"github.com/example/splunk-ds-camr/internal/runner"
+)
+
+func TestWildcardOverrides(t *testing.T) {
+	three := 3
+	cfg := &config.Config{
+		Destinations: map[string][]string{"dest1": {"lane1"}, "dest2": {"lane2"}},
+		CMDB: config.CMDBConfig{Type: "dummy", Dummy: config.DummyCMDBConfig{Entries: []config.DummyCMDBEntry{
+			{Hostname: "api01-east-1", BusinessServiceLane: "lane1,lane2"},
+			{Hostname: "api02-east-1", BusinessServiceLane: "lane1,lane2"},
+		}}},
+		Serverclass: config.ServerclassConfig{
+			Path:           "/serverclass.conf",
+			AppClass:       map[string]string{"app1": "class1", "app2": "class2", "app3": "class3"},
+			AppDestination: map[string]string{"app1": "dest1", "app2": "dest2", "app3": "dest2"},
+		},
+		Wildcard: config.WildcardConfig{
+			Mode:         "trailingOnly",
+			MinGroupSize: 2,
+			Destinations: map[string]config.WildcardOptions{"dest2": {Mode: "internalNumeric"}},
+			Classes:      map[string]config.WildcardOptions{"class3": {MinGroupSize: 3, RequireMinFixedPrefix: &three}},
+		},
+	}
+	r, err := runner.New(cfg, cmdb.NewDummy(cfg.CMDB.Dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "/serverclass.conf", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tg, _ := r.Target("")
+	tg.Updater.SetFS(mem)
+	if err := r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"class1": "api01-east-1,api02-east-1", // global trailingOnly: no common numeric suffix group
+		"class2": "api*-east-*",               // destination override
+		"class3": "api01-east-1,api02-east-1", // class override: groups of 3 or more only
+	}
+	for class, w := range want {
+		got, err := tg.Updater.Whitelist(class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != w {
+			t.Errorf("%s whitelist = %v, want %s", class, got, w)
+		}
+		// status and explain report each class's own patterns, not its destination's
+		cw, err := r.ClassWhitelist("", class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(cw.Computed, ",") != w {
+			t.Errorf("%s computed whitelist = %v, want %s", class, cw.Computed, w)
+		}
+	}
+	ex, err := r.Explain(context.Background(), "api01-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range ex.Targets[0].Classes {
+		if want := map[string]string{"class1": "api01-east-1", "class2": "api*-east-*", "class3": "api01-east-1"}[c.Class]; strings.Join(c.Patterns, ",") != want {
+			t.Errorf("explained %s patterns = %v, want %s", c.Class, c.Patterns, want)
+		}
+	}
+
+	eff := cfg.Wildcard.For("dest2", "class3")
+	if eff.Mode != "internalNumeric" || eff.MinGroupSize != 3 || eff.RequireMinFixedPrefix != 3 {
+		t.Fatalf("effective options = %+v", eff)
+	}
+}